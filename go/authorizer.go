@@ -0,0 +1,102 @@
+package hellojohn
+
+// RequirementKind identifies which claim set a Requirement is checked against.
+type RequirementKind int
+
+const (
+	// RequirementScope is checked against Claims.Scopes.
+	RequirementScope RequirementKind = iota + 1
+
+	// RequirementRole is checked against Claims.Roles.
+	RequirementRole
+
+	// RequirementPermission is checked against Claims.Permissions.
+	RequirementPermission
+)
+
+// String returns the lowercase name of the kind ("scope", "role", "permission").
+func (k RequirementKind) String() string {
+	switch k {
+	case RequirementScope:
+		return "scope"
+	case RequirementRole:
+		return "role"
+	case RequirementPermission:
+		return "permission"
+	}
+	return "unknown"
+}
+
+// Requirement is a single authorization check requested by a RequireX middleware
+// or listed in a Chain.
+type Requirement struct {
+	Kind  RequirementKind
+	Value string
+
+	// AnyOf, when non-empty, makes the requirement pass if any of the listed
+	// values passes; Value is ignored. The Authorizer is only ever asked about
+	// one value at a time.
+	AnyOf []string
+}
+
+// Denial describes a request rejected for an unmet requirement, as reported to
+// Config.OnDenial.
+type Denial struct {
+	// Subject is the UserID of the rejected claims, empty if the request was
+	// not authenticated.
+	Subject string
+
+	// Requirement is the requirement that was not met.
+	Requirement Requirement
+
+	// Granted is what the subject had of the requirement's kind: its scopes,
+	// roles or permissions.
+	Granted []string
+}
+
+func newDenial(claims *Claims, req Requirement) Denial {
+	d := Denial{Requirement: req}
+	if claims == nil {
+		return d
+	}
+	d.Subject = claims.UserID
+	switch req.Kind {
+	case RequirementScope:
+		d.Granted = cloneStrings(claims.Scopes)
+	case RequirementRole:
+		d.Granted = cloneStrings(claims.Roles)
+	case RequirementPermission:
+		d.Granted = cloneStrings(claims.Permissions)
+	}
+	return d
+}
+
+// Authorizer decides whether verified claims satisfy a requirement.
+// Implementations can encode rules such as "scope admin implies all scopes".
+type Authorizer interface {
+	Authorize(claims *Claims, required Requirement) bool
+}
+
+// AuthorizerFunc adapts an ordinary function to the Authorizer interface.
+type AuthorizerFunc func(claims *Claims, required Requirement) bool
+
+// Authorize calls f(claims, required).
+func (f AuthorizerFunc) Authorize(claims *Claims, required Requirement) bool {
+	return f(claims, required)
+}
+
+// DefaultAuthorizer performs exact membership checks using HasScope,
+// HasRole and HasPermission. It is used when Config.Authorizer is nil.
+var DefaultAuthorizer Authorizer = AuthorizerFunc(defaultAuthorize)
+
+func defaultAuthorize(claims *Claims, required Requirement) bool {
+	switch required.Kind {
+	case RequirementScope:
+		return claims.HasScope(required.Value)
+	case RequirementRole:
+		return claims.HasRole(required.Value)
+	case RequirementPermission:
+		return claims.HasPermission(required.Value)
+	}
+	return false
+}
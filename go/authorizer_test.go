@@ -0,0 +1,131 @@
+package hellojohn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// adminImpliesAll grants every requirement to holders of the admin scope and
+// otherwise falls back to the default exact-match logic.
+var adminImpliesAll = AuthorizerFunc(func(claims *Claims, required Requirement) bool {
+	if claims.HasScope("admin") {
+		return true
+	}
+	return DefaultAuthorizer.Authorize(claims, required)
+})
+
+func newAuthorizerTestClient(t *testing.T, a Authorizer) *Client {
+	t.Helper()
+	c, err := New(Config{Domain: "https://test.example.com", Authorizer: a})
+	if err != nil {
+		t.Fatalf("failed to create test client: %v", err)
+	}
+	return c
+}
+
+func TestDefaultAuthorizer_ExactMatch(t *testing.T) {
+	claims := &Claims{
+		Scopes:      []string{"read"},
+		Roles:       []string{"editor"},
+		Permissions: []string{"users:read"},
+	}
+	cases := []struct {
+		req  Requirement
+		want bool
+	}{
+		{Requirement{Kind: RequirementScope, Value: "read"}, true},
+		{Requirement{Kind: RequirementScope, Value: "write"}, false},
+		{Requirement{Kind: RequirementRole, Value: "editor"}, true},
+		{Requirement{Kind: RequirementRole, Value: "read"}, false},
+		{Requirement{Kind: RequirementPermission, Value: "users:read"}, true},
+		{Requirement{Kind: RequirementPermission, Value: "editor"}, false},
+		{Requirement{Value: "read"}, false},
+	}
+	for _, tc := range cases {
+		if got := DefaultAuthorizer.Authorize(claims, tc.req); got != tc.want {
+			t.Errorf("Authorize(%v %q) = %v; want %v", tc.req.Kind, tc.req.Value, got, tc.want)
+		}
+	}
+}
+
+func TestRequirementKind_String(t *testing.T) {
+	if got := RequirementPermission.String(); got != "permission" {
+		t.Errorf("RequirementPermission.String() = %q; want %q", got, "permission")
+	}
+	if got := RequirementKind(0).String(); got != "unknown" {
+		t.Errorf("RequirementKind(0).String() = %q; want %q", got, "unknown")
+	}
+}
+
+func TestCustomAuthorizer_AdminImpliesAll(t *testing.T) {
+	c := newAuthorizerTestClient(t, adminImpliesAll)
+	claims := &Claims{Scopes: []string{"admin"}}
+
+	middlewares := map[string]func(http.Handler) http.Handler{
+		"scope":      c.RequireScope("billing:write"),
+		"role":       c.RequireRole("owner"),
+		"permission": c.RequirePermission("users:delete"),
+	}
+	for name, mw := range middlewares {
+		handler := claimsInjector(claims)(mw(okHandler))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d; want %d", name, rec.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestCustomAuthorizer_FallsBackToExactMatch(t *testing.T) {
+	c := newAuthorizerTestClient(t, adminImpliesAll)
+	claims := &Claims{Scopes: []string{"read"}}
+	handler := claimsInjector(claims)(c.RequireScope("write")(okHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestCustomAuthorizer_ReceivesRequirement(t *testing.T) {
+	var got Requirement
+	c := newAuthorizerTestClient(t, AuthorizerFunc(func(claims *Claims, required Requirement) bool {
+		got = required
+		return true
+	}))
+	handler := claimsInjector(&Claims{})(c.RequireRole("auditor")(okHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got.Kind != RequirementRole || got.Value != "auditor" {
+		t.Errorf("Authorize received %+v; want role auditor", got)
+	}
+}
+
+func TestCustomAuthorizer_NotCalledWithoutClaims(t *testing.T) {
+	called := false
+	c := newAuthorizerTestClient(t, AuthorizerFunc(func(claims *Claims, required Requirement) bool {
+		called = true
+		return true
+	}))
+	handler := c.RequireScope("read")(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if called {
+		t.Error("Authorizer was called without claims in context")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusForbidden)
+	}
+}
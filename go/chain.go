@@ -0,0 +1,158 @@
+package hellojohn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Scope returns a Requirement for the given scope.
+func Scope(scope string) Requirement {
+	return Requirement{Kind: RequirementScope, Value: scope}
+}
+
+// Role returns a Requirement for the given role.
+func Role(role string) Requirement {
+	return Requirement{Kind: RequirementRole, Value: role}
+}
+
+// Permission returns a Requirement for the given permission.
+func Permission(perm string) Requirement {
+	return Requirement{Kind: RequirementPermission, Value: perm}
+}
+
+// AnyScope returns a Requirement satisfied by any one of the given scopes.
+func AnyScope(scopes ...string) Requirement {
+	return Requirement{Kind: RequirementScope, AnyOf: scopes}
+}
+
+// AnyRole returns a Requirement satisfied by any one of the given roles.
+func AnyRole(roles ...string) Requirement {
+	return Requirement{Kind: RequirementRole, AnyOf: roles}
+}
+
+// AnyPermission returns a Requirement satisfied by any one of the given permissions.
+func AnyPermission(perms ...string) Requirement {
+	return Requirement{Kind: RequirementPermission, AnyOf: perms}
+}
+
+// Chain returns middleware that verifies the bearer token and then checks reqs
+// in order, stopping at the first one that fails:
+//
+//	mux.Handle("/admin", hellojohn.Chain(client,
+//		hellojohn.Scope("admin"),
+//		hellojohn.AnyRole("owner", "operator"),
+//	)(handler))
+//
+// Returns 401 if the token is missing or invalid, and
+// Config.InsufficientScopeStatus (default 403) naming the first failed
+// requirement in the "required" field otherwise.
+func Chain(c *Client, reqs ...Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		check := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			for _, req := range reqs {
+				if claims == nil || !c.authorize(claims, req) {
+					c.writeForbidden(w, r, claims, req, req.required())
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+		return c.RequireAuth(check)
+	}
+}
+
+// Route is a handler and the requirements Mount protects it with.
+type Route struct {
+	Handler      http.Handler
+	Requirements []Requirement
+}
+
+// Mount registers each route on mux under its path pattern, wrapped in
+// Chain(c, route.Requirements...). A route without requirements still
+// requires a valid token.
+//
+//	hellojohn.Mount(mux, client, map[string]hellojohn.Route{
+//		"/orders":       {Handler: orders, Requirements: []hellojohn.Requirement{hellojohn.Scope("orders:read")}},
+//		"/admin/users/": {Handler: admin, Requirements: []hellojohn.Requirement{hellojohn.Role("admin")}},
+//	})
+func Mount(mux *http.ServeMux, c *Client, routes map[string]Route) {
+	for pattern, route := range routes {
+		mux.Handle(pattern, Chain(c, route.Requirements...)(route.Handler))
+	}
+}
+
+// ClaimsHandlerFunc is an HTTP handler that receives the verified claims.
+type ClaimsHandlerFunc func(w http.ResponseWriter, r *http.Request, claims *Claims)
+
+// HandlerWithScopes returns a handler that verifies the bearer token, requires
+// every one of scopes, and calls fn with the claims, as
+// Chain(c, Scope(s)...) does for each s:
+//
+//	mux.Handle("/orders", hellojohn.HandlerWithScopes(client, []string{"orders:read"},
+//		func(w http.ResponseWriter, r *http.Request, claims *hellojohn.Claims) {
+//			fmt.Fprintf(w, "orders for %s", claims.TenantID)
+//		}))
+func HandlerWithScopes(c *Client, scopes []string, fn ClaimsHandlerFunc) http.Handler {
+	reqs := make([]Requirement, len(scopes))
+	for i, s := range scopes {
+		reqs[i] = Scope(s)
+	}
+	return Chain(c, reqs...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fn(w, r, ClaimsFromContext(r.Context()))
+	}))
+}
+
+// Authorize verifies token and checks req in one call, for service code that
+// receives a token outside an HTTP handler. It is Guard with a single
+// requirement and has the same error contract.
+func (c *Client) Authorize(ctx context.Context, token string, req Requirement) (*Claims, error) {
+	return c.Guard(ctx, token, req)
+}
+
+// Guard verifies token and checks reqs in order, like Chain but without HTTP,
+// for transports such as JSON-RPC or message consumers. A missing or invalid
+// token yields ErrUnauthorized, wrapping the verification error if any, so
+// errors.Is matches both ErrUnauthorized and, say, ErrTokenExpired; the first
+// unmet requirement yields ErrForbidden. Config.ClaimsTransformer is not
+// applied.
+func (c *Client) Guard(ctx context.Context, token string, reqs ...Requirement) (*Claims, error) {
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing token", ErrUnauthorized)
+	}
+	claims, err := c.VerifyToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	for _, req := range reqs {
+		if !c.authorize(claims, req) {
+			return nil, fmt.Errorf("%w: insufficient %s %q", ErrForbidden, req.Kind, req.required())
+		}
+	}
+	return claims, nil
+}
+
+// authorize evaluates req with the configured Authorizer, expanding AnyOf
+// into one call per value.
+func (c *Client) authorize(claims *Claims, req Requirement) bool {
+	if len(req.AnyOf) == 0 {
+		return c.config.Authorizer.Authorize(claims, req)
+	}
+	for _, v := range req.AnyOf {
+		if c.config.Authorizer.Authorize(claims, Requirement{Kind: req.Kind, Value: v}) {
+			return true
+		}
+	}
+	return false
+}
+
+// required returns the value reported for req in the error envelope. Any-of
+// requirements list their alternatives space-separated, like the scope claim.
+func (r Requirement) required() string {
+	if len(r.AnyOf) > 0 {
+		return strings.Join(r.AnyOf, " ")
+	}
+	return r.Value
+}
@@ -0,0 +1,261 @@
+package hellojohn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newChainTestClient returns a client backed by a test JWKS server and a
+// helper that signs tokens carrying the given scopes and roles.
+func newChainTestClient(t *testing.T) (*Client, func(scopes, roles []string) string) {
+	t.Helper()
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	sign := func(scopes, roles []string) string {
+		return signTestToken(t, priv, map[string]interface{}{
+			"sub":   "user-1",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scp":   scopes,
+			"roles": roles,
+		})
+	}
+	return c, sign
+}
+
+func serveChain(t *testing.T, h http.Handler, token string) (*httptest.ResponseRecorder, errorResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var body errorResponse
+	if rec.Code != http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode error body: %v", err)
+		}
+	}
+	return rec, body
+}
+
+func TestChain_MissingToken(t *testing.T) {
+	c, _ := newChainTestClient(t)
+	rec, _ := serveChain(t, Chain(c, Scope("read"))(okHandler), "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestChain_InvalidToken(t *testing.T) {
+	c, _ := newChainTestClient(t)
+	rec, _ := serveChain(t, Chain(c, Scope("read"))(okHandler), "not.a.token")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestChain_AllSatisfied(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	h := Chain(c, Scope("read"), Role("admin"), AnyScope("write", "delete"))(okHandler)
+	rec, _ := serveChain(t, h, sign([]string{"read", "delete"}, []string{"admin"}))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestChain_ReportsFirstFailure(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	// Both the role and the second scope are missing; the role comes first.
+	h := Chain(c, Scope("read"), Role("admin"), Scope("write"))(okHandler)
+	rec, body := serveChain(t, h, sign([]string{"read"}, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if body.Message != "insufficient role" || body.Required != "admin" {
+		t.Errorf("body = %+v, want role admin", body)
+	}
+}
+
+func TestChain_OrderDeterminesAttribution(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	token := sign(nil, nil)
+
+	_, body := serveChain(t, Chain(c, Scope("write"), Role("admin"))(okHandler), token)
+	if body.Required != "write" {
+		t.Errorf("Required = %q, want write", body.Required)
+	}
+	_, body = serveChain(t, Chain(c, Role("admin"), Scope("write"))(okHandler), token)
+	if body.Required != "admin" {
+		t.Errorf("Required = %q, want admin", body.Required)
+	}
+}
+
+func TestChain_AnyScopeFailure(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	h := Chain(c, AnyScope("write", "delete"))(okHandler)
+	rec, body := serveChain(t, h, sign([]string{"read"}, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if body.Message != "insufficient scope" || body.Required != "write delete" {
+		t.Errorf("body = %+v, want scope \"write delete\"", body)
+	}
+}
+
+func TestChain_UsesAuthorizer(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	var asked []string
+	c = c.WithAuthorizer(AuthorizerFunc(func(_ *Claims, req Requirement) bool {
+		asked = append(asked, req.Value)
+		return req.Value == "b"
+	}))
+	h := Chain(c, AnyPermission("a", "b", "c"))(okHandler)
+	rec, _ := serveChain(t, h, sign(nil, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if len(asked) != 2 || asked[0] != "a" || asked[1] != "b" {
+		t.Errorf("Authorizer asked %v, want [a b]", asked)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	ctx := context.Background()
+
+	claims, err := c.Authorize(ctx, sign([]string{"orders:read"}, nil), Scope("orders:read"))
+	if err != nil {
+		t.Fatalf("Authorize() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want user-1", claims.UserID)
+	}
+
+	_, err = c.Authorize(ctx, sign([]string{"orders:read"}, nil), Scope("orders:write"))
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("wrong scope: error = %v; want ErrForbidden", err)
+	}
+
+	_, err = c.Authorize(ctx, "not.a.token", Scope("orders:read"))
+	if !errors.Is(err, ErrUnauthorized) || !errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrForbidden) {
+		t.Errorf("invalid token: error = %v; want ErrUnauthorized wrapping ErrInvalidToken", err)
+	}
+
+	_, err = c.Authorize(ctx, "", Scope("orders:read"))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("empty token: error = %v; want ErrUnauthorized", err)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	ctx := context.Background()
+	token := sign([]string{"orders:read"}, []string{"admin"})
+
+	claims, err := c.Guard(ctx, token, Scope("orders:read"), Role("admin"))
+	if err != nil {
+		t.Fatalf("Guard() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want user-1", claims.UserID)
+	}
+	if _, err := c.Guard(ctx, token); err != nil {
+		t.Errorf("Guard() without requirements error: %v", err)
+	}
+
+	_, err = c.Guard(ctx, token, Scope("orders:read"), Role("owner"))
+	if !errors.Is(err, ErrForbidden) || !strings.Contains(err.Error(), `"owner"`) {
+		t.Errorf("missing role: error = %v; want ErrForbidden naming owner", err)
+	}
+
+	_, err = c.Guard(ctx, "not.a.token", Scope("orders:read"))
+	if !errors.Is(err, ErrUnauthorized) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("invalid token: error = %v; want ErrUnauthorized wrapping ErrInvalidToken", err)
+	}
+
+	_, err = c.Guard(ctx, "")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("empty token: error = %v; want ErrUnauthorized", err)
+	}
+}
+
+func TestMount(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	mux := http.NewServeMux()
+	Mount(mux, c, map[string]Route{
+		"/orders": {Handler: okHandler, Requirements: []Requirement{Scope("orders:read")}},
+		"/admin":  {Handler: okHandler, Requirements: []Requirement{Role("admin")}},
+		"/me":     {Handler: okHandler},
+	})
+
+	reader := sign([]string{"orders:read"}, nil)
+	admin := sign(nil, []string{"admin"})
+	tests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{"/orders", reader, http.StatusOK},
+		{"/orders", admin, http.StatusForbidden},
+		{"/admin", admin, http.StatusOK},
+		{"/admin", reader, http.StatusForbidden},
+		{"/me", reader, http.StatusOK},
+		{"/me", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestHandlerWithScopes_PassesClaims(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	var seen *Claims
+	h := HandlerWithScopes(c, []string{"orders:read", "orders:write"}, func(w http.ResponseWriter, r *http.Request, claims *Claims) {
+		seen = claims
+	})
+
+	rec, _ := serveChain(t, h, sign([]string{"orders:read", "orders:write"}, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", rec.Code)
+	}
+	if seen == nil || seen.UserID != "user-1" {
+		t.Errorf("handler claims = %+v; want UserID user-1", seen)
+	}
+}
+
+func TestHandlerWithScopes_MissingScope(t *testing.T) {
+	c, sign := newChainTestClient(t)
+	called := false
+	h := HandlerWithScopes(c, []string{"orders:read", "orders:write"}, func(w http.ResponseWriter, r *http.Request, claims *Claims) {
+		called = true
+	})
+
+	rec, body := serveChain(t, h, sign([]string{"orders:read"}, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d; want 403", rec.Code)
+	}
+	if body.Required != "orders:write" {
+		t.Errorf("required = %q; want orders:write", body.Required)
+	}
+	if called {
+		t.Error("handler called despite missing scope")
+	}
+}
@@ -1,5 +1,11 @@
 package hellojohn
 
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
 // Claims represents the verified JWT claims from a HelloJohn token.
 type Claims struct {
 	// UserID is the subject claim (sub). For M2M tokens, this is the client ID.
@@ -29,14 +35,173 @@ type Claims struct {
 	// ExpiresAt is the exp claim (Unix timestamp).
 	ExpiresAt int64
 
+	// NotBefore is the nbf claim (Unix timestamp). Zero if absent.
+	NotBefore int64
+
+	// AuthTime is the auth_time claim (Unix timestamp): when the user last
+	// actively authenticated. Zero if absent.
+	AuthTime int64
+
 	// Issuer is the iss claim.
 	Issuer string
 
-	// Raw contains all JWT payload claims as a map.
+	// AuthorizedParty is the azp claim: the client the token was issued to.
+	AuthorizedParty string
+
+	// AuthMethods is the amr claim: how the user authenticated, e.g. "pwd"
+	// or "mfa".
+	AuthMethods []string
+
+	// AuthContextClass is the acr claim: the assurance level the
+	// authentication satisfied. Empty if absent.
+	AuthContextClass string
+
+	// Actor is the acting party from the act claim (RFC 8693) when the token
+	// was issued through delegation. Nil otherwise.
+	Actor *Actor
+
+	// Header holds the verified token's JOSE header parameters.
+	Header TokenHeader
+
+	// Raw contains all JWT payload claims as a map. Numbers are float64 or
+	// json.Number depending on Config.RawNumberMode; FloatClaim and IntClaim
+	// read them in either form.
 	Raw map[string]interface{}
 
 	// Token is the original JWT string.
 	Token string
+
+	// rawJSON is the decoded payload segment exactly as signed.
+	rawJSON []byte
+
+	// sets caches ScopeSet, RoleSet and PermissionSet. Nil for claims not
+	// produced by the SDK, which compute the sets on each call.
+	sets *claimSets
+}
+
+// claimSets holds the lazily built membership sets of a Claims.
+type claimSets struct {
+	scopes, roles, perms lazySet
+}
+
+type lazySet struct {
+	once sync.Once
+	set  map[string]struct{}
+}
+
+func (l *lazySet) get(values []string) map[string]struct{} {
+	l.once.Do(func() { l.set = stringSet(values) })
+	return l.set
+}
+
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+// RawJSON returns the token payload exactly as it was signed. Unlike
+// re-marshaling Raw, it preserves key order and the precision of large
+// integers. Returns nil for claims not produced by verification.
+func (c *Claims) RawJSON() []byte {
+	if c.rawJSON == nil {
+		return nil
+	}
+	out := make([]byte, len(c.rawJSON))
+	copy(out, c.rawJSON)
+	return out
+}
+
+// Clone returns a deep copy of c, including the slices, the Raw map and any
+// nested maps or arrays within it, and the Actor chain. Callers that want to
+// modify claims taken from a request context should modify a clone.
+func (c *Claims) Clone() *Claims {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	out.Scopes = cloneStrings(c.Scopes)
+	out.Roles = cloneStrings(c.Roles)
+	out.Permissions = cloneStrings(c.Permissions)
+	out.AuthMethods = cloneStrings(c.AuthMethods)
+	out.Actor = c.Actor.clone()
+	out.rawJSON = c.RawJSON()
+	out.sets = new(claimSets)
+	if c.Raw != nil {
+		out.Raw = cloneJSONValue(c.Raw).(map[string]interface{})
+	}
+	return &out
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	out := make([]string, len(s))
+	copy(out, s)
+	return out
+}
+
+// cloneJSONValue deep-copies a value produced by JSON decoding. Scalars are
+// immutable and returned as-is.
+func cloneJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = cloneJSONValue(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = cloneJSONValue(e)
+		}
+		return out
+	case []string:
+		return cloneStrings(v)
+	}
+	return v
+}
+
+// TokenHeader is the subset of the JOSE header kept after verification.
+type TokenHeader struct {
+	// Alg is the signing algorithm, the one that matched the resolved key.
+	Alg string
+
+	// Kid is the key ID, empty if the token had none.
+	Kid string
+
+	// Typ is the token type, e.g. "JWT" or "at+jwt", empty if absent.
+	Typ string
+}
+
+// Actor identifies a party acting on behalf of the token subject.
+type Actor struct {
+	// Subject is the actor's sub.
+	Subject string
+
+	// Issuer is the actor's iss, if present.
+	Issuer string
+
+	// Actor is the prior actor in a delegation chain (nested act), if any.
+	Actor *Actor
+}
+
+func (a *Actor) clone() *Actor {
+	if a == nil {
+		return nil
+	}
+	out := *a
+	out.Actor = a.Actor.clone()
+	return &out
+}
+
+// IsDelegated returns true if the token carries an act claim.
+func (c *Claims) IsDelegated() bool {
+	return c.Actor != nil
 }
 
 // HasScope returns true if the claims contain the given scope.
@@ -68,3 +233,161 @@ func (c *Claims) HasPermission(perm string) bool {
 	}
 	return false
 }
+
+// HasAnyScope returns true if the claims contain at least one of the given
+// scopes. It returns false when called with no scopes.
+func (c *Claims) HasAnyScope(scopes ...string) bool {
+	return containsAny(c.Scopes, scopes)
+}
+
+// HasAllScopes returns true if the claims contain every one of the given
+// scopes. It returns true when called with no scopes.
+func (c *Claims) HasAllScopes(scopes ...string) bool {
+	return containsAll(c.Scopes, scopes)
+}
+
+// HasAnyRole returns true if the claims contain at least one of the given
+// roles. It returns false when called with no roles.
+func (c *Claims) HasAnyRole(roles ...string) bool {
+	return containsAny(c.Roles, roles)
+}
+
+// HasAllRoles returns true if the claims contain every one of the given
+// roles. It returns true when called with no roles.
+func (c *Claims) HasAllRoles(roles ...string) bool {
+	return containsAll(c.Roles, roles)
+}
+
+// HasAnyPermission returns true if the claims contain at least one of the
+// given permissions. It returns false when called with no permissions.
+func (c *Claims) HasAnyPermission(perms ...string) bool {
+	return containsAny(c.Permissions, perms)
+}
+
+// HasAllPermissions returns true if the claims contain every one of the given
+// permissions. It returns true when called with no permissions.
+func (c *Claims) HasAllPermissions(perms ...string) bool {
+	return containsAll(c.Permissions, perms)
+}
+
+// ScopeSet returns Scopes as a set, for callers testing membership many
+// times. For claims from verification or Clone the set is built on the first
+// call and cached, and concurrent calls are safe; it reflects Scopes as of
+// that first call, so modify a Clone rather than the claims themselves. The
+// returned map is shared and must not be modified.
+func (c *Claims) ScopeSet() map[string]struct{} {
+	if c.sets == nil {
+		return stringSet(c.Scopes)
+	}
+	return c.sets.scopes.get(c.Scopes)
+}
+
+// RoleSet returns Roles as a set, cached like ScopeSet.
+func (c *Claims) RoleSet() map[string]struct{} {
+	if c.sets == nil {
+		return stringSet(c.Roles)
+	}
+	return c.sets.roles.get(c.Roles)
+}
+
+// PermissionSet returns Permissions as a set, cached like ScopeSet.
+func (c *Claims) PermissionSet() map[string]struct{} {
+	if c.sets == nil {
+		return stringSet(c.Permissions)
+	}
+	return c.sets.perms.get(c.Permissions)
+}
+
+func containsAny(have, want []string) bool {
+	for _, w := range want {
+		if containsString(have, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !containsString(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// IntClaim returns the named claim from Raw as an int64. Integers are exact
+// across the full int64 range, also when Raw holds float64 values, as long as
+// the claims came from verification; fractional numbers are truncated.
+// Returns false if the claim is absent or not a number.
+func (c *Claims) IntClaim(name string) (int64, bool) {
+	v := c.Raw[name]
+	if _, isFloat := v.(float64); isFloat && c.rawJSON != nil {
+		if exact, err := decodePayload(c.rawJSON); err == nil {
+			v = exact[name]
+		}
+	}
+	return toInt64(v)
+}
+
+// FloatClaim returns the named claim from Raw as a float64, whether Raw holds
+// it as a float64 or a json.Number. Returns false if the claim is absent or
+// not a number.
+func (c *Claims) FloatClaim(name string) (float64, bool) {
+	switch n := c.Raw[name].(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// IssuedBefore reports whether the token was issued before t, by its iat
+// claim. A token without iat counts as issued before any t.
+func (c *Claims) IssuedBefore(t time.Time) bool {
+	return c.IssuedAt == 0 || time.Unix(c.IssuedAt, 0).Before(t)
+}
+
+// IssuedAfter reports whether the token was issued after t, by its iat
+// claim. A token without iat is never issued after t.
+func (c *Claims) IssuedAfter(t time.Time) bool {
+	return c.IssuedAt != 0 && time.Unix(c.IssuedAt, 0).After(t)
+}
+
+// MaxCacheTTL returns how long, as of now, anything derived from the token may
+// be cached: the time until ExpiresAt, or zero if the token has expired or
+// carries no exp claim.
+func (c *Claims) MaxCacheTTL(now time.Time) time.Duration {
+	if c.ExpiresAt == 0 {
+		return 0
+	}
+	ttl := time.Unix(c.ExpiresAt, 0).Sub(now)
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// Subject returns the token subject (sub claim). It is the same as UserID.
+func (c *Claims) Subject() string {
+	return c.UserID
+}
+
+// Audiences returns the aud claim from Raw, normalizing the single-string and
+// array forms to a slice. Returns nil if aud is absent.
+func (c *Claims) Audiences() []string {
+	switch aud := c.Raw["aud"].(type) {
+	case string:
+		if aud == "" {
+			return nil
+		}
+		return []string{aud}
+	case []interface{}:
+		return extractStringSlice(aud)
+	case []string:
+		return aud
+	}
+	return nil
+}
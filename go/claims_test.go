@@ -1,6 +1,12 @@
 package hellojohn
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestHasScope_Present(t *testing.T) {
 	c := &Claims{Scopes: []string{"read", "write", "admin"}}
@@ -165,3 +171,318 @@ func TestClaims_MultipleValues(t *testing.T) {
 		t.Errorf("HasPermission(\"admin\") = true; want false")
 	}
 }
+
+func TestHasAnyAll(t *testing.T) {
+	c := &Claims{
+		Scopes:      []string{"read", "write"},
+		Roles:       []string{"admin", "editor"},
+		Permissions: []string{"users:read", "users:write"},
+	}
+	tests := []struct {
+		name     string
+		have     []string
+		any, all func(...string) bool
+	}{
+		{"scopes", c.Scopes, c.HasAnyScope, c.HasAllScopes},
+		{"roles", c.Roles, c.HasAnyRole, c.HasAllRoles},
+		{"permissions", c.Permissions, c.HasAnyPermission, c.HasAllPermissions},
+	}
+	for _, tt := range tests {
+		if tt.any() {
+			t.Errorf("%s: HasAny() with no values = true; want false", tt.name)
+		}
+		if !tt.all() {
+			t.Errorf("%s: HasAll() with no values = false; want true", tt.name)
+		}
+		if !tt.any("missing", tt.have[0]) {
+			t.Errorf("%s: HasAny(missing, %s) = false; want true", tt.name, tt.have[0])
+		}
+		if tt.all("missing", tt.have[0]) {
+			t.Errorf("%s: HasAll(missing, %s) = true; want false", tt.name, tt.have[0])
+		}
+		if !tt.all(tt.have...) {
+			t.Errorf("%s: HasAll(%v) = false; want true", tt.name, tt.have)
+		}
+		if tt.any("missing", "absent") {
+			t.Errorf("%s: HasAny(missing, absent) = true; want false", tt.name)
+		}
+	}
+}
+
+func TestSubject_ReturnsUserID(t *testing.T) {
+	c := &Claims{UserID: "user-1"}
+	if got := c.Subject(); got != "user-1" {
+		t.Errorf("Subject() = %q; want %q", got, "user-1")
+	}
+}
+
+func TestAudiences_SingleString(t *testing.T) {
+	c := &Claims{Raw: map[string]interface{}{"aud": "https://api.example.com"}}
+	got := c.Audiences()
+	if len(got) != 1 || got[0] != "https://api.example.com" {
+		t.Errorf("Audiences() = %v; want [https://api.example.com]", got)
+	}
+}
+
+func TestAudiences_Array(t *testing.T) {
+	c := &Claims{Raw: map[string]interface{}{"aud": []interface{}{"api-1", "api-2"}}}
+	got := c.Audiences()
+	if len(got) != 2 || got[0] != "api-1" || got[1] != "api-2" {
+		t.Errorf("Audiences() = %v; want [api-1 api-2]", got)
+	}
+}
+
+func TestAudiences_Absent(t *testing.T) {
+	c := &Claims{Raw: map[string]interface{}{}}
+	if got := c.Audiences(); got != nil {
+		t.Errorf("Audiences() = %v; want nil", got)
+	}
+	if got := (&Claims{}).Audiences(); got != nil {
+		t.Errorf("Audiences() with nil Raw = %v; want nil", got)
+	}
+}
+
+func TestRawJSON_NilForConstructedClaims(t *testing.T) {
+	c := &Claims{UserID: "user-1"}
+	if got := c.RawJSON(); got != nil {
+		t.Errorf("RawJSON() = %s; want nil", got)
+	}
+}
+
+func TestIntClaim(t *testing.T) {
+	c := &Claims{Raw: map[string]interface{}{
+		"big":   json.Number("9223372036854775807"),
+		"small": float64(42),
+		"name":  "alice",
+	}}
+	if got, ok := c.IntClaim("big"); !ok || got != 9223372036854775807 {
+		t.Errorf("IntClaim(big) = %d, %v; want max int64, true", got, ok)
+	}
+	if got, ok := c.IntClaim("small"); !ok || got != 42 {
+		t.Errorf("IntClaim(small) = %d, %v; want 42, true", got, ok)
+	}
+	if _, ok := c.IntClaim("name"); ok {
+		t.Error("IntClaim(name) ok = true; want false")
+	}
+	if _, ok := c.IntClaim("missing"); ok {
+		t.Error("IntClaim(missing) ok = true; want false")
+	}
+}
+
+func TestFloatClaim(t *testing.T) {
+	c := &Claims{Raw: map[string]interface{}{
+		"f":    float64(1.5),
+		"n":    json.Number("2.25"),
+		"name": "alice",
+	}}
+	if got, ok := c.FloatClaim("f"); !ok || got != 1.5 {
+		t.Errorf("FloatClaim(f) = %v, %v; want 1.5, true", got, ok)
+	}
+	if got, ok := c.FloatClaim("n"); !ok || got != 2.25 {
+		t.Errorf("FloatClaim(n) = %v, %v; want 2.25, true", got, ok)
+	}
+	if _, ok := c.FloatClaim("name"); ok {
+		t.Error("FloatClaim(name) ok = true; want false")
+	}
+	if _, ok := c.FloatClaim("missing"); ok {
+		t.Error("FloatClaim(missing) ok = true; want false")
+	}
+}
+
+func TestClone_IndependentSlices(t *testing.T) {
+	orig := &Claims{
+		UserID:      "user-1",
+		Scopes:      []string{"read", "write"},
+		Roles:       []string{"admin"},
+		Permissions: []string{"users:read"},
+		Actor:       &Actor{Subject: "svc", Actor: &Actor{Subject: "root"}},
+		rawJSON:     []byte(`{"sub":"user-1"}`),
+	}
+	c := orig.Clone()
+
+	c.Scopes[0] = "changed"
+	c.Scopes = append(c.Scopes, "extra")
+	c.Roles[0] = "changed"
+	c.Permissions[0] = "changed"
+	c.Actor.Actor.Subject = "changed"
+	c.rawJSON[0] = 'x'
+
+	if orig.Scopes[0] != "read" || len(orig.Scopes) != 2 {
+		t.Errorf("original Scopes = %v; want [read write]", orig.Scopes)
+	}
+	if orig.Roles[0] != "admin" || orig.Permissions[0] != "users:read" {
+		t.Errorf("original Roles/Permissions modified: %v %v", orig.Roles, orig.Permissions)
+	}
+	if orig.Actor.Actor.Subject != "root" {
+		t.Errorf("original nested actor = %q; want root", orig.Actor.Actor.Subject)
+	}
+	if string(orig.RawJSON()) != `{"sub":"user-1"}` {
+		t.Errorf("original RawJSON = %s", orig.RawJSON())
+	}
+}
+
+func TestClone_IndependentRaw(t *testing.T) {
+	orig := &Claims{Raw: map[string]interface{}{
+		"sub":  "user-1",
+		"meta": map[string]interface{}{"plan": "pro"},
+		"tags": []interface{}{"a", map[string]interface{}{"k": "v"}},
+	}}
+	c := orig.Clone()
+
+	c.Raw["sub"] = "changed"
+	c.Raw["new"] = true
+	c.Raw["meta"].(map[string]interface{})["plan"] = "free"
+	tags := c.Raw["tags"].([]interface{})
+	tags[0] = "changed"
+	tags[1].(map[string]interface{})["k"] = "changed"
+
+	if orig.Raw["sub"] != "user-1" {
+		t.Errorf("original sub = %v", orig.Raw["sub"])
+	}
+	if _, ok := orig.Raw["new"]; ok {
+		t.Error("key added to clone appeared in original")
+	}
+	if got := orig.Raw["meta"].(map[string]interface{})["plan"]; got != "pro" {
+		t.Errorf("original nested plan = %v; want pro", got)
+	}
+	origTags := orig.Raw["tags"].([]interface{})
+	if origTags[0] != "a" || origTags[1].(map[string]interface{})["k"] != "v" {
+		t.Errorf("original tags = %v", origTags)
+	}
+}
+
+func TestClone_Nil(t *testing.T) {
+	var c *Claims
+	if c.Clone() != nil {
+		t.Error("nil.Clone() != nil")
+	}
+}
+
+func TestMaxCacheTTL(t *testing.T) {
+	exp := time.Unix(1_700_000_000, 0)
+	c := &Claims{ExpiresAt: exp.Unix()}
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Duration
+	}{
+		{"an hour before", exp.Add(-time.Hour), time.Hour},
+		{"half a second before", exp.Add(-500 * time.Millisecond), 500 * time.Millisecond},
+		{"at expiry", exp, 0},
+		{"after expiry", exp.Add(time.Minute), 0},
+	}
+	for _, tt := range tests {
+		if got := c.MaxCacheTTL(tt.now); got != tt.want {
+			t.Errorf("%s: MaxCacheTTL() = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMaxCacheTTL_NoExpiry(t *testing.T) {
+	c := &Claims{}
+	if got := c.MaxCacheTTL(time.Now()); got != 0 {
+		t.Errorf("MaxCacheTTL() = %v; want 0 without exp", got)
+	}
+}
+
+func TestScopeSet(t *testing.T) {
+	c := &Claims{
+		Scopes:      []string{"read", "write"},
+		Roles:       []string{"admin"},
+		Permissions: []string{"users:delete"},
+	}
+	if _, ok := c.ScopeSet()["write"]; !ok || len(c.ScopeSet()) != 2 {
+		t.Errorf("ScopeSet() = %v", c.ScopeSet())
+	}
+	if _, ok := c.RoleSet()["admin"]; !ok || len(c.RoleSet()) != 1 {
+		t.Errorf("RoleSet() = %v", c.RoleSet())
+	}
+	if _, ok := c.PermissionSet()["users:delete"]; !ok || len(c.PermissionSet()) != 1 {
+		t.Errorf("PermissionSet() = %v", c.PermissionSet())
+	}
+}
+
+func TestScopeSet_Uncached(t *testing.T) {
+	c := &Claims{Scopes: []string{"read"}}
+	c.ScopeSet()
+	c.Scopes = append(c.Scopes, "write")
+	if _, ok := c.ScopeSet()["write"]; !ok {
+		t.Error("ScopeSet() on hand-built claims should reflect later changes")
+	}
+}
+
+func TestScopeSet_CachedAndClone(t *testing.T) {
+	c := &Claims{Scopes: []string{"read"}, sets: new(claimSets)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := c.ScopeSet()["read"]; !ok {
+				t.Error("ScopeSet() missing read")
+			}
+		}()
+	}
+	wg.Wait()
+
+	clone := c.Clone()
+	clone.Scopes = append(clone.Scopes, "write")
+	if _, ok := clone.ScopeSet()["write"]; !ok {
+		t.Error("clone ScopeSet() missing write")
+	}
+	if _, ok := c.ScopeSet()["write"]; ok {
+		t.Error("original ScopeSet() picked up the clone's scope")
+	}
+}
+
+func benchmarkClaims() *Claims {
+	scopes := make([]string, 20)
+	for i := range scopes {
+		scopes[i] = fmt.Sprintf("resource%d:read", i)
+	}
+	return &Claims{Scopes: scopes, sets: new(claimSets)}
+}
+
+func BenchmarkHasScope(b *testing.B) {
+	c := benchmarkClaims()
+	for i := 0; i < b.N; i++ {
+		for _, s := range c.Scopes {
+			c.HasScope(s)
+		}
+	}
+}
+
+func BenchmarkScopeSet(b *testing.B) {
+	c := benchmarkClaims()
+	for i := 0; i < b.N; i++ {
+		set := c.ScopeSet()
+		for _, s := range c.Scopes {
+			_ = set[s]
+		}
+	}
+}
+
+func TestIssuedBeforeAfter(t *testing.T) {
+	cutoff := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name   string
+		iat    int64
+		before bool
+		after  bool
+	}{
+		{"just before", cutoff.Unix() - 1, true, false},
+		{"at cutoff", cutoff.Unix(), false, false},
+		{"just after", cutoff.Unix() + 1, false, true},
+		{"no iat", 0, true, false},
+	}
+	for _, tt := range tests {
+		c := &Claims{IssuedAt: tt.iat}
+		if got := c.IssuedBefore(cutoff); got != tt.before {
+			t.Errorf("%s: IssuedBefore() = %v; want %v", tt.name, got, tt.before)
+		}
+		if got := c.IssuedAfter(cutoff); got != tt.after {
+			t.Errorf("%s: IssuedAfter() = %v; want %v", tt.name, got, tt.after)
+		}
+	}
+}
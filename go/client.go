@@ -2,8 +2,12 @@ package hellojohn
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,15 +19,274 @@ type Config struct {
 	// Audience is the expected JWT audience claim. Optional.
 	Audience string
 
+	// Audiences lists further accepted audiences; a token matching Audience
+	// or any of these passes. Optional.
+	Audiences []string
+
+	// AudienceFunc, if set, is called on every verification and the
+	// audiences it returns are accepted along with Audience and Audiences,
+	// so accepted audiences can change at runtime, e.g. during a blue/green
+	// cutover. It must be safe for concurrent use and fast. Setting it always
+	// enables the audience check, even while it returns nothing. Optional.
+	AudienceFunc func() []string
+
+	// DeprecatedAudiences are still accepted but reported through
+	// OnDeprecatedAudience, to track stragglers during an audience rename.
+	// Optional.
+	DeprecatedAudiences []string
+
+	// OnDeprecatedAudience is called with the matched audience when a token is
+	// accepted only because of DeprecatedAudiences. It runs synchronously on
+	// the verification path and must be fast. Optional.
+	OnDeprecatedAudience func(aud string)
+
 	// JWKSCacheTTL is how long to cache JWKS keys. Default: 1 hour.
 	JWKSCacheTTL time.Duration
+
+	// PrewarmJWKS makes New fetch the JWKS before returning, so the first
+	// request does not pay for the fetch. A failed prewarm is not an error
+	// (keys are fetched on first use as usual) unless PrewarmRequired is set;
+	// it is logged with the standard logger. Call Client.Prewarm directly to
+	// handle the error yourself. Optional.
+	PrewarmJWKS bool
+
+	// PrewarmRequired makes New fail with ErrJWKSFetchFailed when the prewarm
+	// fetch fails. It implies PrewarmJWKS. Optional.
+	PrewarmRequired bool
+
+	// JWKSStaleWhileRevalidate bounds how long past JWKSCacheTTL cached keys
+	// may still be served when the JWKS endpoint cannot be reached. Within the
+	// window, failed refreshes are retried at most every 30 seconds instead of
+	// on every request. Zero serves cached keys for as long as refreshes fail.
+	JWKSStaleWhileRevalidate time.Duration
+
+	// MaxTokenBytes is the maximum accepted length of a raw JWT. Larger tokens
+	// are rejected before any decoding takes place. Default: 8192.
+	MaxTokenBytes int
+
+	// ClockSkew, when set, is the tolerance applied to both the exp and nbf
+	// checks, to absorb clock drift between the issuer and this service.
+	// Setting it opts into leeway on exp: an expired token is accepted for up
+	// to *ClockSkew longer. A zero value allows no tolerance on either check.
+	// Default (nil): exp is strict and nbf may be up to DefaultNotBeforeSkew
+	// in the future.
+	ClockSkew *time.Duration
+
+	// TenantJWKSURL, when set, derives the JWKS URL from the token's tid claim
+	// so that each tenant can sign with its own keys. The tid is read from the
+	// unverified payload only to select the key set; the signature is still
+	// checked against that tenant's keys. Return "" to reject a tenant.
+	// Tokens without a tid use the Domain JWKS. Optional.
+	//
+	// TenantJWKSURL must return "" for tenants it does not know. The tid is
+	// attacker-controlled and each URL returned is fetched before the
+	// signature is checked, so mapping any tid to a URL lets made-up tenants
+	// trigger outbound requests. At most 256 tenant and issuer key sets are
+	// cached; a key set whose first fetch fails is not kept.
+	TenantJWKSURL func(tid string) string
+
+	// AllowedIssuers, when non-empty, restricts accepted tokens to those whose
+	// iss claim is in the list. Keys are fetched from each issuer's own
+	// /.well-known/jwks.json (unless TenantJWKSURL selects a tenant JWKS).
+	// Optional.
+	AllowedIssuers []string
+
+	// RequireIssuerMatchesDomain rejects tokens whose iss claim is not Domain
+	// or a path below it (e.g. Domain + "/tenants/acme"), as a safeguard
+	// against tokens from an unrelated issuer that shares a key. Leave it off
+	// when the issuer legitimately differs from the URL the SDK talks to,
+	// such as a public issuer name in front of an internal Domain; use
+	// AllowedIssuers instead. Optional.
+	RequireIssuerMatchesDomain bool
+
+	// ExpectedAuthorizedParty, when set, rejects tokens whose azp claim is
+	// absent or different, so a token issued to one client cannot be
+	// replayed against a service that expects another. Optional.
+	ExpectedAuthorizedParty string
+
+	// AllowedTenants, when non-empty, restricts accepted tokens to those whose
+	// tid claim is in the list; others, including tokens without a tid, fail
+	// with ErrForbidden and ErrTenantNotAllowed. The check runs after the
+	// signature is verified and applies regardless of any per-request tenant
+	// matching. Optional.
+	AllowedTenants []string
+
+	// InsufficientScopeStatus is the HTTP status written by RequireScope,
+	// RequireRole and RequirePermission when the check fails. Default: 403.
+	// With 403, a WWW-Authenticate: Bearer error="insufficient_scope" header
+	// is added as described in RFC 6750.
+	InsufficientScopeStatus int
+
+	// ClaimHeaders names the headers InjectClaimHeaders sets from the claims.
+	// Default: DefaultClaimHeaders.
+	ClaimHeaders HeaderClaimMapping
+
+	// ErrorBodyTemplate renames the fields of the middleware's JSON error
+	// bodies. Default: {"error": ..., "message": ...}.
+	ErrorBodyTemplate ErrorBodyTemplate
+
+	// HTTPClient is used to fetch JWKS documents. Default: a client built on
+	// DefaultTransport with a 10 second timeout.
+	HTTPClient *http.Client
+
+	// ExtraHeaders are added to every JWKS request, e.g. an API key required
+	// by a gateway in front of the auth server. They cannot replace the
+	// Accept-Encoding header the SDK sets itself. Optional.
+	ExtraHeaders map[string]string
+
+	// Authorizer evaluates RequireScope, RequireRole and RequirePermission
+	// checks. Default: DefaultAuthorizer (exact match).
+	Authorizer Authorizer
+
+	// ClaimsTransformer, if set, is applied by RequireAuth to verified claims
+	// before they are stored in the request context, e.g. to map legacy roles
+	// or enrich claims from a local store. It may modify and return its
+	// argument or return new claims; an error or nil claims yields 401.
+	// Optional.
+	ClaimsTransformer func(ctx context.Context, c *Claims) (*Claims, error)
+
+	// OnAuthSuccess, if set, is called by RequireAuth with the final claims
+	// (after ClaimsTransformer) once per authenticated request, before the
+	// next handler runs. It runs synchronously on the request goroutine and
+	// delays every authenticated request by its duration, so it must be fast
+	// or hand its work off to another goroutine; ctx is the request context
+	// and is cancelled when the request ends. Optional.
+	OnAuthSuccess func(ctx context.Context, c *Claims)
+
+	// OnDenial, if set, is called each time RequireScope, RequireRole,
+	// RequirePermission, RequireResourceScope or Chain rejects a request, with
+	// the unmet requirement and what the subject was granted, e.g. to log
+	// authorization failures in staging. The token itself is not included.
+	// It runs synchronously before the response is written. Optional.
+	OnDenial func(ctx context.Context, d Denial)
+
+	// ScopeClaimStrategy decides how scopes are read when a token carries both
+	// scp and scope. Default: ScpPrecedence.
+	ScopeClaimStrategy ScopeClaimStrategy
+
+	// AllowMissingKid accepts tokens without a kid header by trying every
+	// key in the JWKS until one verifies the signature. Off by default: it
+	// costs one signature check per key and lets any key in the set sign
+	// for any token. Optional.
+	AllowMissingKid bool
+
+	// InsecureDevBypass makes VerifyToken accept unsigned tokens of the form
+	// "dev.<base64url(JSON claims)>" and trust their claims, for local
+	// development without an auth server. It only takes effect when Domain
+	// is a localhost or loopback URL, and New logs a warning either way.
+	// DANGEROUS: never enable it in a deployed service. Optional.
+	InsecureDevBypass bool
+
+	// TolerantBase64 accepts token segments in standard base64, padded or
+	// not, when they are not valid base64url, for issuers that encode JWTs
+	// incorrectly. The signature is still checked over the segments exactly
+	// as received. Off by default. Optional.
+	TolerantBase64 bool
+
+	// RawNumberMode selects how numbers appear in Claims.Raw. Default:
+	// RawFloat64. IntClaim is exact in either mode. Optional.
+	RawNumberMode RawNumberMode
+
+	// ClaimMapping renames the claims the verifier reads. Optional.
+	ClaimMapping ClaimMapping
+
+	// RolesExtractor, if set, computes Claims.Roles from the verified payload,
+	// for issuers whose roles are not a single string array, and takes
+	// precedence over ClaimMapping.RolesClaim. See KeycloakRolesExtractor.
+	// Optional.
+	RolesExtractor func(payload map[string]interface{}) []string
+
+	// SubjectValidator, if set, is called with the sub claim of every token
+	// that is otherwise valid; an error rejects the token with
+	// ErrInvalidToken. See UUIDSubjectValidator. Optional.
+	SubjectValidator func(sub string) error
+
+	// RejectTokensIssuedBefore, if set, rejects every token whose iat is
+	// earlier, or that has no iat, as a cheap emergency revocation after a
+	// key compromise or mass logout. Optional.
+	RejectTokensIssuedBefore time.Time
+
+	// PreVerifyHook, if set, is called with the token's header before any
+	// key lookup or signature check, to cheaply drop tokens by kid, alg or
+	// typ. An error rejects the token with ErrInvalidToken wrapping it.
+	// Optional.
+	PreVerifyHook func(header TokenHeader) error
+
+	// Trace, if set, is called once per VerifyToken with the time spent in
+	// each verification phase, for latency profiling. It runs synchronously
+	// on the verifying goroutine. Optional.
+	Trace func(VerifyTrace)
+}
+
+// ClaimMapping names the payload claims that populate Claims fields, for
+// issuers that do not use HelloJohn's claim names.
+type ClaimMapping struct {
+	// RolesClaim is the claim read into Claims.Roles. It is looked up first
+	// as a top-level key, so namespaced names such as
+	// "https://myapp.example.com/roles" work as-is, and otherwise as a dotted
+	// path into nested objects, e.g. "realm_access.roles". Default: "roles".
+	RolesClaim string
 }
 
+// RawNumberMode selects the Go type of JSON numbers in Claims.Raw.
+type RawNumberMode int
+
+const (
+	// RawFloat64 stores numbers as float64, the encoding/json default.
+	// Integers beyond 2^53 lose precision.
+	RawFloat64 RawNumberMode = iota
+
+	// RawJSONNumber stores numbers as json.Number, preserving them exactly.
+	// Code that type-asserts float64 on Raw values must switch to
+	// Claims.FloatClaim or Claims.IntClaim.
+	RawJSONNumber
+)
+
+// ScopeClaimStrategy selects how the scp and scope claims are combined into
+// Claims.Scopes when both are present. With only one present, it is used
+// under every strategy.
+type ScopeClaimStrategy int
+
+const (
+	// ScpPrecedence uses scp and ignores scope.
+	ScpPrecedence ScopeClaimStrategy = iota
+
+	// ScopePrecedence uses scope and ignores scp.
+	ScopePrecedence
+
+	// Union uses every scope found in either claim, scp first, without
+	// duplicates.
+	Union
+)
+
+const (
+	// DefaultMaxTokenBytes is the default value for Config.MaxTokenBytes.
+	DefaultMaxTokenBytes = 8192
+
+	// DefaultNotBeforeSkew is how far in the future nbf may be when
+	// Config.ClockSkew is nil.
+	DefaultNotBeforeSkew = 30 * time.Second
+)
+
 // Client is the main HelloJohn SDK client for Go backends.
 // It verifies JWTs and provides HTTP middleware.
 type Client struct {
 	config   Config
 	verifier *JWTVerifier
+
+	// httpClient is the HTTP client New created because Config.HTTPClient
+	// was nil; Close closes its idle connections. Derived clients leave it
+	// nil, as the client they came from owns it.
+	httpClient *http.Client
+
+	// closed is set by Close on this client only. parent is the client c was
+	// derived from, nil for a client made by New; closing it closes c too.
+	closed *atomic.Bool
+	parent *Client
+
+	// m2m holds the M2MClients reported by DebugHandler, shared with
+	// derived clients.
+	m2m *m2mRegistry
 }
 
 // New creates a new HelloJohn client. It initializes the JWKS cache
@@ -37,16 +300,179 @@ func New(cfg Config) (*Client, error) {
 	if cfg.JWKSCacheTTL == 0 {
 		cfg.JWKSCacheTTL = time.Hour
 	}
+	if cfg.MaxTokenBytes == 0 {
+		cfg.MaxTokenBytes = DefaultMaxTokenBytes
+	}
+	if cfg.InsufficientScopeStatus == 0 {
+		cfg.InsufficientScopeStatus = http.StatusForbidden
+	}
+	if cfg.Authorizer == nil {
+		cfg.Authorizer = DefaultAuthorizer
+	}
+	var ownHTTPClient *http.Client
+	if cfg.HTTPClient == nil {
+		ownHTTPClient = newDefaultHTTPClient()
+		cfg.HTTPClient = ownHTTPClient
+	}
+
+	verifier := newJWTVerifier(cfg)
+	verifier.devBypass = devBypassEnabled(cfg)
+
+	c := &Client{
+		config:     cfg,
+		verifier:   verifier,
+		httpClient: ownHTTPClient,
+		closed:     new(atomic.Bool),
+		m2m:        new(m2mRegistry),
+	}
+	if cfg.PrewarmJWKS || cfg.PrewarmRequired {
+		if err := c.Prewarm(context.Background()); err != nil {
+			if cfg.PrewarmRequired {
+				return nil, err
+			}
+			log.Printf("hellojohn: WARNING: JWKS prewarm failed, keys will be fetched on first use: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// Prewarm fetches the key sets c will verify against: the JWKS of each of
+// Config.AllowedIssuers if set, otherwise the Domain JWKS. Tenant key sets
+// are selected per token and are not prewarmed. Prewarm is safe to call at
+// any time; a fetch within the last few minutes is not repeated.
+func (c *Client) Prewarm(ctx context.Context) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	return c.verifier.prewarm(ctx)
+}
+
+// Close releases the client's resources. When Config.HTTPClient is nil, idle
+// connections of the HTTP client New created for c are closed; a
+// caller-supplied HTTPClient belongs to the caller and is left alone. Other
+// Clients and M2MClients are unaffected. The client runs no background
+// goroutines, so there is nothing else to stop. The client, and any client
+// derived from it with WithAudience or WithAuthorizer, is unusable
+// afterwards: VerifyToken returns ErrClientClosed. Closing a derived client
+// closes only that client; the client it came from keeps working. Close is
+// idempotent.
+func (c *Client) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
 
-	verifier := newJWTVerifier(cfg.Domain, cfg.Audience, cfg.JWKSCacheTTL)
+// isClosed reports whether c, or a client it was derived from, was closed.
+func (c *Client) isClosed() bool {
+	for ; c != nil; c = c.parent {
+		if c.closed.Load() {
+			return true
+		}
+	}
+	return false
+}
 
-	return &Client{
-		config:   cfg,
-		verifier: verifier,
-	}, nil
+// derive returns a copy of c that shares its caches but can be closed on its
+// own.
+func (c *Client) derive() *Client {
+	derived := *c
+	derived.httpClient = nil
+	derived.closed = new(atomic.Bool)
+	derived.parent = c
+	return &derived
 }
 
 // VerifyToken verifies a JWT token and returns the parsed claims.
-func (c *Client) VerifyToken(ctx context.Context, token string) (*Claims, error) {
-	return c.verifier.Verify(ctx, token)
+// Options relax or tighten individual checks for this call only. A leading
+// "Bearer " (any case), as in an Authorization header value, is ignored.
+func (c *Client) VerifyToken(ctx context.Context, token string, opts ...VerifyOption) (*Claims, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	return c.verifier.Verify(ctx, token, opts...)
+}
+
+// VerifyForLogout verifies token's signature and claims like VerifyToken but
+// accepts it after it has expired, so a logout handler can identify the
+// subject whose server-side state to clean up. It is
+// VerifyToken(ctx, token, WithoutExpiryCheck()) under a name that makes the
+// weaker guarantee plain: the result must never be used to grant access.
+func (c *Client) VerifyForLogout(ctx context.Context, token string) (*Claims, error) {
+	return c.VerifyToken(ctx, token, WithoutExpiryCheck())
+}
+
+// VerifyTyped verifies token with c and then decodes the signed payload into
+// a new T, giving typed access to custom claims:
+//
+//	type MyClaims struct {
+//		Email string `json:"email"`
+//		OrgID string `json:"org_id"`
+//	}
+//	claims, mine, err := hellojohn.VerifyTyped[MyClaims](ctx, client, token)
+//
+// A payload that does not fit T is reported as an error; the token itself
+// was valid.
+func VerifyTyped[T any](ctx context.Context, c *Client, token string, opts ...VerifyOption) (*Claims, *T, error) {
+	claims, err := c.VerifyToken(ctx, token, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := new(T)
+	if err := json.Unmarshal(claims.rawJSON, out); err != nil {
+		return nil, nil, fmt.Errorf("hellojohn: decode claims into %T: %w", out, err)
+	}
+	return claims, out, nil
+}
+
+// WithAudience returns a client that expects the given audience and is
+// otherwise identical to c. The derived client shares c's JWKS cache, so
+// keys fetched by either are visible to both.
+func (c *Client) WithAudience(aud string) *Client {
+	derived := c.derive()
+	derived.config.Audience = aud
+	derived.verifier = c.verifier.withAudience(aud)
+	return derived
+}
+
+// WithAuthorizer returns a client that evaluates RequireScope, RequireRole and
+// RequirePermission with a instead of c's authorizer. A nil a selects
+// DefaultAuthorizer. The derived client shares c's JWKS cache.
+func (c *Client) WithAuthorizer(a Authorizer) *Client {
+	if a == nil {
+		a = DefaultAuthorizer
+	}
+	derived := c.derive()
+	derived.config.Authorizer = a
+	return derived
+}
+
+// SetAudiences replaces the audiences set by Config.Audience and
+// Config.Audiences while c is in use, for services whose configuration
+// changes at runtime; with none, the audience check is disabled unless
+// Config.AudienceFunc or Config.DeprecatedAudiences is set. The JWKS cache is
+// kept. It is safe to call concurrently with VerifyToken: each verification
+// sees either the old audiences or the new ones, never a mix. Clients
+// derived with WithAudience are not affected.
+func (c *Client) SetAudiences(audiences ...string) {
+	audiences = cloneStrings(audiences)
+	updatePolicy(c.verifier.policy, func(p *verifyPolicy) {
+		p.audience = ""
+		p.audiences = audiences
+	})
+}
+
+// SetAllowedIssuers replaces Config.AllowedIssuers while c is in use, under
+// the same guarantees as SetAudiences; with none, any issuer is accepted
+// again. Key sets already fetched for an issuer stay cached. Unlike the
+// audiences, the allowlist is shared with every client derived from c, or
+// that c was derived from, so removing an issuer takes effect on all of them.
+func (c *Client) SetAllowedIssuers(issuers ...string) {
+	allowed := newVerifyPolicy("", nil, issuers).allowedIssuers
+	updatePolicy(c.verifier.issuerSource(), func(p *verifyPolicy) {
+		p.allowedIssuers = allowed
+	})
 }
@@ -1,6 +1,16 @@
 package hellojohn
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -115,3 +125,430 @@ func TestNew_DomainWithoutTrailingSlash(t *testing.T) {
 			client.config.Domain, "https://auth.example.com")
 	}
 }
+
+func TestWithAudience_SharesJWKSCache(t *testing.T) {
+	srv, priv, fetches := newCountingJWKSServer(t)
+	base, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	orders := base.WithAudience("orders-api")
+	billing := base.WithAudience("billing-api")
+
+	ordersToken := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "orders-api"})
+	billingToken := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "billing-api"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := orders.VerifyToken(context.Background(), ordersToken); err != nil {
+				t.Errorf("orders VerifyToken() error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := billing.VerifyToken(context.Background(), billingToken); err != nil {
+				t.Errorf("billing VerifyToken() error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := orders.VerifyToken(context.Background(), billingToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("orders VerifyToken(billing token) error = %v; want ErrInvalidToken", err)
+	}
+	if _, err := billing.VerifyToken(context.Background(), ordersToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("billing VerifyToken(orders token) error = %v; want ErrInvalidToken", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("JWKS fetches = %d; want 1", n)
+	}
+}
+
+func TestWithAudience_DoesNotModifyBase(t *testing.T) {
+	base, err := New(Config{Domain: "https://auth.example.com", Audience: "base"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	derived := base.WithAudience("derived")
+
+	if base.config.Audience != "base" || base.verifier.policy.Load().audience != "base" {
+		t.Errorf("base audience changed to %q/%q", base.config.Audience, base.verifier.policy.Load().audience)
+	}
+	if derived.config.Audience != "derived" || derived.verifier.policy.Load().audience != "derived" {
+		t.Errorf("derived audience = %q/%q; want derived", derived.config.Audience, derived.verifier.policy.Load().audience)
+	}
+	if derived.verifier.jwks != base.verifier.jwks {
+		t.Error("derived client does not share the base JWKS cache")
+	}
+}
+
+func TestWithAuthorizer_NilUsesDefault(t *testing.T) {
+	base, err := New(Config{Domain: "https://auth.example.com"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	derived := base.WithAuthorizer(nil)
+	if derived.config.Authorizer == nil {
+		t.Error("WithAuthorizer(nil) left Authorizer nil; want DefaultAuthorizer")
+	}
+}
+
+func TestSetAudiences_KeepsJWKSCache(t *testing.T) {
+	srv, priv, fetches := newCountingJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, Audience: "api-a"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	tokenB := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "api-b"})
+
+	if _, err := c.VerifyToken(context.Background(), tokenB); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("before SetAudiences: error = %v; want ErrInvalidToken", err)
+	}
+	c.SetAudiences("api-b", "api-c")
+	if _, err := c.VerifyToken(context.Background(), tokenB); err != nil {
+		t.Errorf("after SetAudiences: error = %v", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("JWKS fetched %d times; want 1", n)
+	}
+}
+
+func TestSetAllowedIssuers(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, AllowedIssuers: []string{"https://other.example.com"}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "iss": srv.URL})
+
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("before SetAllowedIssuers: error = %v; want ErrInvalidToken", err)
+	}
+	c.SetAllowedIssuers(srv.URL + "/")
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Errorf("after SetAllowedIssuers: error = %v", err)
+	}
+	c.SetAllowedIssuers()
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Errorf("after clearing AllowedIssuers: error = %v", err)
+	}
+}
+
+func TestSetAllowedIssuers_ReachesDerivedClients(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	base, err := New(Config{Domain: srv.URL, AllowedIssuers: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	derived := map[string]*Client{
+		"WithAudience":   base.WithAudience("api"),
+		"WithAuthorizer": base.WithAuthorizer(nil),
+		"nested":         base.WithAudience("other").WithAudience("api"),
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "iss": srv.URL, "aud": "api"})
+	for name, d := range derived {
+		if _, err := d.VerifyToken(context.Background(), token); err != nil {
+			t.Fatalf("%s: before removing the issuer: error = %v", name, err)
+		}
+	}
+
+	base.SetAllowedIssuers("https://other.example.com")
+	for name, d := range derived {
+		if _, err := d.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: after removing the issuer: error = %v; want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+// TestSetAudiences_ConcurrentWithVerify is meant for the race detector:
+// every verification must see one complete audience list or the other.
+func TestSetAudiences_ConcurrentWithVerify(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, Audience: "api-a"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "api-a"})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				c.SetAudiences("api-b")
+			} else {
+				c.SetAudiences("api-a", "api-b")
+			}
+		}
+	}()
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				_, err := c.VerifyToken(context.Background(), token)
+				if err != nil && !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("VerifyToken() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+func TestClose_Idempotent(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken() before Close error: %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close() error: %v", err)
+	}
+
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("VerifyToken() after Close error = %v; want ErrClientClosed", err)
+	}
+}
+
+func TestClose_LeavesOtherClientsConnections(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	var closedConns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testJWKS(pub)) //nolint:errcheck
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			atomic.AddInt32(&closedConns, 1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	var clients [2]*Client
+	for i := range clients {
+		c, err := New(Config{Domain: srv.URL})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		if _, err := c.VerifyToken(context.Background(), token); err != nil {
+			t.Fatalf("VerifyToken() error: %v", err)
+		}
+		clients[i] = c
+	}
+	if clients[0].httpClient == clients[1].httpClient {
+		t.Fatal("clients share an HTTP client; want one each")
+	}
+
+	if err := clients[0].Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&closedConns) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&closedConns); n != 1 {
+		t.Errorf("closed connections = %d; want 1 (only the closed client's)", n)
+	}
+}
+
+func TestClose_DerivedClientsClosed(t *testing.T) {
+	c, err := New(Config{Domain: "https://auth.example.com"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	derived := c.WithAudience("api")
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if _, err := derived.VerifyToken(context.Background(), "a.b.c"); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("derived VerifyToken() error = %v; want ErrClientClosed", err)
+	}
+}
+
+func TestClose_DerivedLeavesBaseOpen(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	base, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	for _, derived := range []*Client{base.WithAudience("api"), base.WithAuthorizer(nil)} {
+		if err := derived.Close(); err != nil {
+			t.Fatalf("Close() error: %v", err)
+		}
+		if _, err := derived.VerifyToken(context.Background(), token); !errors.Is(err, ErrClientClosed) {
+			t.Errorf("derived VerifyToken() error = %v; want ErrClientClosed", err)
+		}
+	}
+	if _, err := base.VerifyToken(context.Background(), token); err != nil {
+		t.Errorf("base VerifyToken() after closing derived clients error: %v", err)
+	}
+}
+
+func TestClose_Concurrent(t *testing.T) {
+	c, err := New(Config{Domain: "https://auth.example.com"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Close(); err != nil {
+				t.Errorf("Close() error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestVerifyTyped(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	type orgClaims struct {
+		Email string `json:"email"`
+		OrgID string `json:"org_id"`
+	}
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub":    "user-1",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"email":  "ada@example.com",
+		"org_id": "org-42",
+	})
+
+	claims, typed, err := VerifyTyped[orgClaims](context.Background(), c, token)
+	if err != nil {
+		t.Fatalf("VerifyTyped() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want user-1", claims.UserID)
+	}
+	if typed.Email != "ada@example.com" || typed.OrgID != "org-42" {
+		t.Errorf("typed = %+v; want email and org_id populated", typed)
+	}
+}
+
+func TestVerifyTyped_InvalidToken(t *testing.T) {
+	srv, _ := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if _, _, err := VerifyTyped[struct{}](context.Background(), c, "not.a.token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyTyped() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyTyped_PayloadDoesNotFit(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "org_id": 42})
+
+	if _, _, err := VerifyTyped[struct {
+		OrgID string `json:"org_id"`
+	}](context.Background(), c, token); err == nil {
+		t.Error("VerifyTyped() error = nil; want decode error")
+	}
+}
+
+func TestNew_PrewarmJWKS(t *testing.T) {
+	srv, priv, fetches := newCountingJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, PrewarmJWKS: true})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Fatalf("JWKS fetched %d times during New; want 1", n)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("JWKS fetched %d times; want 1 (first verification should use prewarmed keys)", n)
+	}
+}
+
+func TestNew_PrewarmFailureNotFatal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	logs := captureLog(t)
+	c, err := New(Config{Domain: srv.URL, PrewarmJWKS: true})
+	if err != nil {
+		t.Fatalf("New() error = %v; want nil when prewarm is not required", err)
+	}
+	if !strings.Contains(logs.String(), "JWKS prewarm failed") {
+		t.Errorf("log = %q; want a prewarm warning", logs.String())
+	}
+	if err := c.Prewarm(context.Background()); !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("Prewarm() error = %v; want ErrJWKSFetchFailed", err)
+	}
+}
+
+func TestNew_PrewarmRequired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := New(Config{Domain: srv.URL, PrewarmRequired: true}); !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("New() error = %v; want ErrJWKSFetchFailed", err)
+	}
+}
+
+func TestPrewarm_AllowedIssuers(t *testing.T) {
+	srvA, _, fetchesA := newCountingJWKSServer(t)
+	srvB, _, fetchesB := newCountingJWKSServer(t)
+	c, err := New(Config{Domain: srvA.URL, AllowedIssuers: []string{srvA.URL, srvB.URL}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if err := c.Prewarm(context.Background()); err != nil {
+		t.Fatalf("Prewarm() error: %v", err)
+	}
+	if atomic.LoadInt32(fetchesA) != 1 || atomic.LoadInt32(fetchesB) != 1 {
+		t.Errorf("fetches = %d, %d; want 1 per issuer", *fetchesA, *fetchesB)
+	}
+}
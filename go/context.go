@@ -17,3 +17,25 @@ func ClaimsFromContext(ctx context.Context) *Claims {
 func contextWithClaims(ctx context.Context, claims *Claims) context.Context {
 	return context.WithValue(ctx, claimsKey, claims)
 }
+
+type requestIDKey struct{}
+
+// RequestIDHeader is the header outbound requests carry the ID stored by
+// ContextWithRequestID in.
+const RequestIDHeader = "X-Request-Id"
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID. JWKS
+// fetches and M2M token requests made with the context send it in the
+// X-Request-Id header, so auth-server calls can be traced to the request
+// that caused them. A fetch shared by concurrent callers carries the ID of
+// the caller that started it.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID stored by ContextWithRequestID, or ""
+// if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
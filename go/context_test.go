@@ -131,3 +131,13 @@ func TestClaimsFromContext_WrongKeyType(t *testing.T) {
 		t.Errorf("ClaimsFromContext with wrong key type = %v; want nil", claims)
 	}
 }
+
+func TestRequestIDFromContext(t *testing.T) {
+	if id := RequestIDFromContext(context.Background()); id != "" {
+		t.Errorf("RequestIDFromContext(empty) = %q; want empty", id)
+	}
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	if id := RequestIDFromContext(ctx); id != "req-42" {
+		t.Errorf("RequestIDFromContext() = %q; want req-42", id)
+	}
+}
@@ -0,0 +1,137 @@
+package hellojohn
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jwksDebugInfo describes one JWKS cache. It never includes key material.
+type jwksDebugInfo struct {
+	URL             string     `json:"jwks_url"`
+	CachedKids      []string   `json:"cached_kids"`
+	LastFetch       *time.Time `json:"last_jwks_fetch"`
+	LastFailure     *time.Time `json:"last_jwks_failure,omitempty"`
+	TTL             string     `json:"jwks_ttl"`
+	StaleGrace      string     `json:"jwks_stale_grace,omitempty"`
+	MinFetchSpacing string     `json:"jwks_min_fetch_interval"`
+}
+
+// debugInfo is the document served by Client.DebugHandler.
+type debugInfo struct {
+	Domain string `json:"domain"`
+	Closed bool   `json:"closed"`
+	jwksDebugInfo
+	// AdditionalJWKS lists the per-tenant and per-issuer caches.
+	AdditionalJWKS []jwksDebugInfo `json:"additional_jwks,omitempty"`
+	// M2M lists the M2MClients added with RegisterM2MClient.
+	M2M []m2mDebugInfo `json:"m2m,omitempty"`
+}
+
+// m2mDebugInfo describes one M2MClient's token cache. CacheEntries is only
+// known for the in-memory cache.
+type m2mDebugInfo struct {
+	ClientID     string `json:"client_id"`
+	TenantID     string `json:"tenant_id,omitempty"`
+	CacheEntries *int   `json:"cache_entries,omitempty"`
+	CacheHits    int64  `json:"cache_hits"`
+	CacheMisses  int64  `json:"cache_misses"`
+}
+
+// m2mRegistry is the set of M2MClients a Client reports on.
+type m2mRegistry struct {
+	mu      sync.Mutex
+	clients []*M2MClient
+}
+
+// RegisterM2MClient adds m's token cache stats to the "m2m" section of
+// DebugHandler. Registering the same client twice has no effect.
+func (c *Client) RegisterM2MClient(m *M2MClient) {
+	c.m2m.mu.Lock()
+	defer c.m2m.mu.Unlock()
+	for _, registered := range c.m2m.clients {
+		if registered == m {
+			return
+		}
+	}
+	c.m2m.clients = append(c.m2m.clients, m)
+}
+
+// DebugHandler returns a handler that reports the client's cache state as
+// JSON: the cached key IDs, when the JWKS was last fetched and when a fetch
+// last failed, and the cache settings, for the domain JWKS and any tenant or
+// issuer JWKS in use, plus cache hit and miss counts for each M2MClient added
+// with RegisterM2MClient. It exposes no keys, tokens or secrets, but does reveal
+// configuration, so mount it behind your own admin authentication.
+func (c *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := debugInfo{
+			Domain:        c.config.Domain,
+			Closed:        c.isClosed(),
+			jwksDebugInfo: c.verifier.jwks.debugInfo(),
+		}
+		if extra := c.verifier.extraJWKS; extra != nil {
+			extra.mu.Lock()
+			caches := make([]*jwksCache, 0, len(extra.byURL))
+			for _, cache := range extra.byURL {
+				caches = append(caches, cache)
+			}
+			extra.mu.Unlock()
+			for _, cache := range caches {
+				info.AdditionalJWKS = append(info.AdditionalJWKS, cache.debugInfo())
+			}
+			sort.Slice(info.AdditionalJWKS, func(i, j int) bool {
+				return info.AdditionalJWKS[i].URL < info.AdditionalJWKS[j].URL
+			})
+		}
+		c.m2m.mu.Lock()
+		for _, m := range c.m2m.clients {
+			info.M2M = append(info.M2M, m.debugInfo())
+		}
+		c.m2m.mu.Unlock()
+		writeJSON(w, http.StatusOK, info)
+	})
+}
+
+func (c *M2MClient) debugInfo() m2mDebugInfo {
+	info := m2mDebugInfo{
+		ClientID:    c.config.ClientID,
+		TenantID:    c.config.TenantID,
+		CacheHits:   c.cacheHits.Load(),
+		CacheMisses: c.cacheMisses.Load(),
+	}
+	if mem, ok := c.cache.(*memoryTokenCache); ok {
+		n := mem.len()
+		info.CacheEntries = &n
+	}
+	return info
+}
+
+func (c *jwksCache) debugInfo() jwksDebugInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	info := jwksDebugInfo{
+		URL:             c.url,
+		CachedKids:      make([]string, 0, len(c.keys)),
+		TTL:             c.ttl.String(),
+		MinFetchSpacing: c.minInterval.String(),
+	}
+	for kid := range c.keys {
+		info.CachedKids = append(info.CachedKids, kid)
+	}
+	sort.Strings(info.CachedKids)
+	if !c.lastFetch.IsZero() {
+		t := c.lastFetch.UTC()
+		info.LastFetch = &t
+	}
+	if !c.lastFailure.IsZero() {
+		t := c.lastFailure.UTC()
+		info.LastFailure = &t
+	}
+	if c.staleGrace > 0 {
+		info.StaleGrace = c.staleGrace.String()
+	}
+	return info
+}
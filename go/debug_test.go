@@ -0,0 +1,111 @@
+package hellojohn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHandler(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var before map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &before); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if before["last_jwks_fetch"] != nil {
+		t.Errorf("last_jwks_fetch = %v before any fetch; want null", before["last_jwks_fetch"])
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q; want application/json", ct)
+	}
+
+	var info struct {
+		CachedKids    []string `json:"cached_kids"`
+		LastJWKSFetch *string  `json:"last_jwks_fetch"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(info.CachedKids) != 1 || info.CachedKids[0] != testKID {
+		t.Errorf("cached_kids = %v; want [%s]", info.CachedKids, testKID)
+	}
+	if info.LastJWKSFetch == nil {
+		t.Fatal("last_jwks_fetch = null after fetch")
+	}
+	if _, err := time.Parse(time.RFC3339, *info.LastJWKSFetch); err != nil {
+		t.Errorf("last_jwks_fetch = %q; want RFC 3339: %v", *info.LastJWKSFetch, err)
+	}
+	if strings.Contains(rec.Body.String(), token) {
+		t.Error("debug output contains the token")
+	}
+}
+
+func TestDebugHandler_M2MStats(t *testing.T) {
+	srv := newMockTokenServer(t)
+	defer srv.Close()
+	m2m, err := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := m2m.GetToken(context.Background(), TokenRequest{Scopes: []string{"read"}}); err != nil {
+			t.Fatalf("GetToken() error: %v", err)
+		}
+	}
+
+	c, err := New(Config{Domain: "https://auth.example.com"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	c.RegisterM2MClient(m2m)
+	c.RegisterM2MClient(m2m)
+
+	rec := httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var info struct {
+		M2M []struct {
+			ClientID     string `json:"client_id"`
+			CacheEntries *int   `json:"cache_entries"`
+			CacheHits    int64  `json:"cache_hits"`
+			CacheMisses  int64  `json:"cache_misses"`
+		} `json:"m2m"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(info.M2M) != 1 {
+		t.Fatalf("m2m = %+v; want one client", info.M2M)
+	}
+	got := info.M2M[0]
+	if got.ClientID != "svc" || got.CacheHits != 2 || got.CacheMisses != 1 {
+		t.Errorf("m2m[0] = %+v; want svc with 2 hits and 1 miss", got)
+	}
+	if got.CacheEntries == nil || *got.CacheEntries != 1 {
+		t.Errorf("cache_entries = %v; want 1", got.CacheEntries)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Error("debug output contains the client secret")
+	}
+}
@@ -0,0 +1,57 @@
+package hellojohn
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// devTokenPrefix marks the unsigned tokens accepted under
+// Config.InsecureDevBypass: "dev." followed by the base64url-encoded claims.
+const devTokenPrefix = "dev."
+
+// isLocalDomain reports whether domain is an http(s) URL whose host is
+// localhost, a *.localhost name or a loopback address.
+func isLocalDomain(domain string) bool {
+	u, err := url.Parse(domain)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// devBypassEnabled resolves Config.InsecureDevBypass, warning on the standard
+// logger whichever way it goes: the bypass must never be on unnoticed, nor
+// silently off for someone who expects it.
+func devBypassEnabled(cfg Config) bool {
+	if !cfg.InsecureDevBypass {
+		return false
+	}
+	if !isLocalDomain(cfg.Domain) {
+		log.Printf("hellojohn: WARNING: InsecureDevBypass ignored: domain %q is not localhost", cfg.Domain)
+		return false
+	}
+	log.Printf("hellojohn: WARNING: InsecureDevBypass is ON: unsigned %q tokens are trusted without verification. Never use this outside local development.", devTokenPrefix)
+	return true
+}
+
+// verifyDevToken builds claims from an unsigned dev token. No signature,
+// time, audience, issuer or tenant check applies.
+func (v *JWTVerifier) verifyDevToken(tokenStr string) (*Claims, error) {
+	payloadBytes, err := v.decodeSegment(strings.TrimPrefix(tokenStr, devTokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid dev token encoding", ErrInvalidToken)
+	}
+	payload, err := decodePayload(payloadBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid dev token JSON", ErrInvalidToken)
+	}
+	return v.buildClaims(payload, payloadBytes, tokenStr), nil
+}
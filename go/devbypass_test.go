@@ -0,0 +1,104 @@
+package hellojohn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger to a buffer for the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prev)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func devToken(claims string) string {
+	return devTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(claims))
+}
+
+func TestInsecureDevBypass_Localhost(t *testing.T) {
+	logs := captureLog(t)
+	c, err := New(Config{Domain: "http://localhost:8080", InsecureDevBypass: true})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "InsecureDevBypass is ON") {
+		t.Errorf("log = %q; want a warning", logs.String())
+	}
+
+	token := devToken(`{"sub":"dev-user","tid":"acme","scope":"read write","roles":["admin"]}`)
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.UserID != "dev-user" || claims.TenantID != "acme" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if !claims.HasAllScopes("read", "write") || !claims.HasRole("admin") {
+		t.Errorf("Scopes = %v, Roles = %v", claims.Scopes, claims.Roles)
+	}
+
+	if _, err := c.VerifyToken(context.Background(), "dev.!!!"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken(bad dev token) error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestInsecureDevBypass_IgnoredForRemoteDomain(t *testing.T) {
+	for _, domain := range []string{"https://auth.example.com", "https://localhost.example.com"} {
+		logs := captureLog(t)
+		c, err := New(Config{Domain: domain, InsecureDevBypass: true})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		if !strings.Contains(logs.String(), "InsecureDevBypass ignored") {
+			t.Errorf("%s: log = %q; want an ignored warning", domain, logs.String())
+		}
+		if _, err := c.VerifyToken(context.Background(), devToken(`{"sub":"dev-user"}`)); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: VerifyToken() error = %v; want ErrInvalidToken", domain, err)
+		}
+	}
+}
+
+func TestInsecureDevBypass_Off(t *testing.T) {
+	logs := captureLog(t)
+	c, err := New(Config{Domain: "http://localhost:8080"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("log = %q; want nothing", logs.String())
+	}
+	if _, err := c.VerifyToken(context.Background(), devToken(`{"sub":"dev-user"}`)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestIsLocalDomain(t *testing.T) {
+	tests := map[string]bool{
+		"http://localhost":         true,
+		"http://localhost:8080":    true,
+		"http://auth.localhost":    true,
+		"http://127.0.0.1:9000":    true,
+		"http://[::1]:9000":        true,
+		"https://auth.example.com": false,
+		"http://10.0.0.5":          false,
+		"localhost":                false,
+	}
+	for domain, want := range tests {
+		if got := isLocalDomain(domain); got != want {
+			t.Errorf("isLocalDomain(%q) = %v; want %v", domain, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package hellojohn
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DefaultIDTokenHeader is the header RequireDualAuth reads the ID token from
+// when no name is given.
+const DefaultIDTokenHeader = "X-Id-Token"
+
+type idTokenClaimsKey struct{}
+
+// IDTokenClaimsFromContext returns the ID token claims injected by
+// RequireDualAuth, or nil if there are none.
+func IDTokenClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(idTokenClaimsKey{}).(*Claims)
+	return claims
+}
+
+// RequireDualAuth returns middleware for requests carrying both an access
+// token and an ID token that must belong to the same subject. The access
+// token is read from accessHeader (default: the Authorization bearer token)
+// and the ID token from idHeader (default X-Id-Token). Both are verified
+// with c's configuration, so Config.Audience or Config.Audiences must accept
+// the ID token's audience too. The access token's claims are injected as by
+// RequireAuth, with Config.ClaimsTransformer and Config.OnAuthSuccess, and
+// the ID token's are available from IDTokenClaimsFromContext. Returns 401 if
+// either token is missing or invalid, 503 as RequireAuth does if the JWKS is
+// unreachable, and 403 if their subjects differ.
+func (c *Client) RequireDualAuth(accessHeader, idHeader string) func(http.Handler) http.Handler {
+	if idHeader == "" {
+		idHeader = DefaultIDTokenHeader
+	}
+	hooks := c.authHooks()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessToken := headerToken(r, accessHeader)
+			idToken := headerToken(r, idHeader)
+			if accessToken == "" || idToken == "" {
+				c.writeError(w, http.StatusUnauthorized, "missing access or ID token")
+				return
+			}
+
+			claims, err := c.VerifyToken(r.Context(), accessToken)
+			if err != nil {
+				writeVerifyFailure(w, err, "invalid token", hooks.errorBody)
+				return
+			}
+			idClaims, err := c.VerifyToken(r.Context(), idToken)
+			if err != nil {
+				writeVerifyFailure(w, err, "invalid ID token", hooks.errorBody)
+				return
+			}
+			if claims.UserID == "" || claims.UserID != idClaims.UserID {
+				c.writeError(w, http.StatusForbidden, "subject mismatch")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), idTokenClaimsKey{}, idClaims)
+			hooks.serve(w, r.WithContext(ctx), claims, next)
+		})
+	}
+}
+
+// headerToken reads a token from the named header. The Authorization header,
+// also selected by an empty name, yields its bearer token; other headers may
+// carry the token bare or after "Bearer ".
+func headerToken(r *http.Request, name string) string {
+	if name == "" || strings.EqualFold(name, "Authorization") {
+		return extractBearerToken(r)
+	}
+	return strings.TrimSpace(r.Header.Get(name))
+}
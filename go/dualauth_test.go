@@ -0,0 +1,85 @@
+package hellojohn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireDualAuth(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	access := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp, "scp": []string{"read"}})
+	idSame := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp, "email": "u@example.com"})
+	idOther := signTestToken(t, priv, map[string]interface{}{"sub": "user-2", "exp": exp})
+
+	var gotAccess, gotID *Claims
+	handler := c.RequireDualAuth("", "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAccess = ClaimsFromContext(r.Context())
+		gotID = IDTokenClaimsFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name    string
+		access  string
+		idToken string
+		want    int
+	}{
+		{"both valid and matching", access, idSame, http.StatusOK},
+		{"subject mismatch", access, idOther, http.StatusForbidden},
+		{"invalid ID token", access, idSame + "x", http.StatusUnauthorized},
+		{"invalid access token", access + "x", idSame, http.StatusUnauthorized},
+		{"missing ID token", access, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		gotAccess, gotID = nil, nil
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.access)
+		if tt.idToken != "" {
+			req.Header.Set(DefaultIDTokenHeader, tt.idToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, rec.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		if gotAccess == nil || !gotAccess.HasScope("read") {
+			t.Errorf("%s: access claims = %+v; want the access token's", tt.name, gotAccess)
+		}
+		if gotID == nil || gotID.Raw["email"] != "u@example.com" {
+			t.Errorf("%s: ID claims = %+v; want the ID token's", tt.name, gotID)
+		}
+	}
+}
+
+func TestRequireDualAuth_CustomHeaders(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	access := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+	idToken := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+
+	handler := c.RequireDualAuth("X-Access-Token", "X-Identity")(okHandler)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Access-Token", access)
+	req.Header.Set("X-Identity", "Bearer "+idToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
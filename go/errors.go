@@ -15,9 +15,25 @@ var (
 	// ErrForbidden is returned when the authenticated user lacks required permissions.
 	ErrForbidden = errors.New("hellojohn: forbidden")
 
+	// ErrAlgorithmMismatch is returned, together with ErrInvalidToken, when the
+	// token's alg header cannot be used with the type of the resolved key.
+	ErrAlgorithmMismatch = errors.New("hellojohn: algorithm does not match key")
+
+	// ErrUnsupportedKey is returned, together with ErrInvalidToken, when the
+	// token's kid names a JWKS key the SDK cannot verify with, such as an
+	// Ed448 key.
+	ErrUnsupportedKey = errors.New("hellojohn: unsupported key")
+
+	// ErrTenantNotAllowed is returned, together with ErrForbidden, when
+	// Config.AllowedTenants is set and the token's tid is not in it.
+	ErrTenantNotAllowed = errors.New("hellojohn: tenant not allowed")
+
 	// ErrM2MAuthFailed is returned when M2M token acquisition fails.
 	ErrM2MAuthFailed = errors.New("hellojohn: m2m auth failed")
 
+	// ErrClientClosed is returned by VerifyToken after Client.Close.
+	ErrClientClosed = errors.New("hellojohn: client closed")
+
 	// ErrJWKSFetchFailed is returned when JWKS endpoint cannot be reached.
 	ErrJWKSFetchFailed = errors.New("hellojohn: jwks fetch failed")
 )
@@ -0,0 +1,138 @@
+// Package hjtest provides an in-memory HelloJohn token issuer for tests.
+//
+// An Issuer generates an Ed25519 keypair, publishes it on a local JWKS
+// endpoint and mints signed tokens that a hellojohn.Client configured with
+// Issuer.Domain() will accept:
+//
+//	iss := hjtest.NewIssuer()
+//	defer iss.Close()
+//
+//	client, _ := hellojohn.New(hellojohn.Config{Domain: iss.Domain()})
+//	token := iss.Mint(hellojohn.Claims{UserID: "user-1", Scopes: []string{"read"}})
+package hjtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	hellojohn "github.com/dropDatabas3/hellojohn-go"
+)
+
+// KeyID is the kid under which the issuer publishes its signing key.
+const KeyID = "hjtest-key"
+
+// Issuer is a test token issuer backed by an httptest.Server.
+type Issuer struct {
+	server     *httptest.Server
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// NewIssuer generates a new Ed25519 keypair and starts a server publishing it
+// at /.well-known/jwks.json. Call Close when done.
+func NewIssuer() *Issuer {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("hjtest: failed to generate key: %v", err))
+	}
+
+	iss := &Issuer{publicKey: pub, privateKey: priv}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", iss.serveJWKS)
+	iss.server = httptest.NewServer(mux)
+	return iss
+}
+
+// Domain returns the base URL to use as hellojohn.Config.Domain.
+func (i *Issuer) Domain() string {
+	return i.server.URL
+}
+
+// Close shuts down the JWKS server.
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// Mint returns a signed JWT carrying the given claims.
+//
+// Entries in claims.Raw are copied into the payload first and are overridden
+// by the typed fields. IssuedAt defaults to now, ExpiresAt to one hour from
+// now and Issuer to Domain(). IsM2M sets amr to ["client"].
+func (i *Issuer) Mint(claims hellojohn.Claims) string {
+	payload := make(map[string]interface{}, len(claims.Raw)+8)
+	for k, v := range claims.Raw {
+		payload[k] = v
+	}
+
+	now := time.Now().Unix()
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now
+	}
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = now + 3600
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = i.Domain()
+	}
+	if claims.UserID == "" {
+		claims.UserID = claims.ClientID
+	}
+
+	payload["iat"] = claims.IssuedAt
+	payload["exp"] = claims.ExpiresAt
+	payload["iss"] = claims.Issuer
+	if claims.UserID != "" {
+		payload["sub"] = claims.UserID
+	}
+	if claims.TenantID != "" {
+		payload["tid"] = claims.TenantID
+	}
+	if claims.Scopes != nil {
+		payload["scp"] = claims.Scopes
+	}
+	if claims.Roles != nil {
+		payload["roles"] = claims.Roles
+	}
+	if claims.Permissions != nil {
+		payload["perms"] = claims.Permissions
+	}
+	if claims.IsM2M {
+		payload["amr"] = []string{"client"}
+	}
+
+	return i.Sign(payload)
+}
+
+// Sign returns a signed JWT for an arbitrary payload. Use it to craft tokens
+// that Mint cannot express, such as expired or malformed claims.
+func (i *Issuer) Sign(payload map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "typ": "JWT", "kid": KeyID})
+	body, err := json.Marshal(payload)
+	if err != nil {
+		panic(fmt.Sprintf("hjtest: failed to encode payload: %v", err))
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	sig := ed25519.Sign(i.privateKey, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (i *Issuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"alg": "EdDSA",
+			"use": "sig",
+			"kid": KeyID,
+			"x":   base64.RawURLEncoding.EncodeToString(i.publicKey),
+		}},
+	})
+}
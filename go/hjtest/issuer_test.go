@@ -0,0 +1,98 @@
+package hjtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	hellojohn "github.com/dropDatabas3/hellojohn-go"
+	"github.com/dropDatabas3/hellojohn-go/hjtest"
+)
+
+func newClient(t *testing.T, iss *hjtest.Issuer) *hellojohn.Client {
+	t.Helper()
+	client, err := hellojohn.New(hellojohn.Config{Domain: iss.Domain()})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return client
+}
+
+func TestIssuer_MintRoundTrip(t *testing.T) {
+	iss := hjtest.NewIssuer()
+	defer iss.Close()
+	client := newClient(t, iss)
+
+	token := iss.Mint(hellojohn.Claims{
+		UserID:      "user-1",
+		TenantID:    "acme",
+		Scopes:      []string{"read", "write"},
+		Roles:       []string{"admin"},
+		Permissions: []string{"users:delete"},
+	})
+
+	claims, err := client.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want %q", claims.UserID, "user-1")
+	}
+	if claims.TenantID != "acme" {
+		t.Errorf("TenantID = %q; want %q", claims.TenantID, "acme")
+	}
+	if !claims.HasScope("write") || !claims.HasRole("admin") || !claims.HasPermission("users:delete") {
+		t.Errorf("claims = %+v; want scope write, role admin, permission users:delete", claims)
+	}
+	if claims.Issuer != iss.Domain() {
+		t.Errorf("Issuer = %q; want %q", claims.Issuer, iss.Domain())
+	}
+}
+
+func TestIssuer_MintM2M(t *testing.T) {
+	iss := hjtest.NewIssuer()
+	defer iss.Close()
+	client := newClient(t, iss)
+
+	token := iss.Mint(hellojohn.Claims{ClientID: "svc-1", IsM2M: true})
+
+	claims, err := client.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if !claims.IsM2M || claims.ClientID != "svc-1" {
+		t.Errorf("IsM2M = %v, ClientID = %q; want true, %q", claims.IsM2M, claims.ClientID, "svc-1")
+	}
+}
+
+func TestIssuer_MintExpired(t *testing.T) {
+	iss := hjtest.NewIssuer()
+	defer iss.Close()
+	client := newClient(t, iss)
+
+	token := iss.Mint(hellojohn.Claims{
+		UserID:    "user-1",
+		ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+	})
+
+	_, err := client.VerifyToken(context.Background(), token)
+	if !errors.Is(err, hellojohn.ErrTokenExpired) {
+		t.Errorf("VerifyToken() error = %v; want ErrTokenExpired", err)
+	}
+}
+
+func TestIssuer_ForeignKeyRejected(t *testing.T) {
+	iss := hjtest.NewIssuer()
+	defer iss.Close()
+	other := hjtest.NewIssuer()
+	defer other.Close()
+	client := newClient(t, iss)
+
+	token := other.Mint(hellojohn.Claims{UserID: "user-1"})
+
+	_, err := client.VerifyToken(context.Background(), token)
+	if !errors.Is(err, hellojohn.ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,140 @@
+package hellojohn
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testHMACSecret = []byte("internal-shared-secret")
+
+// echoBodyHandler writes back the request body and the signature header it saw.
+var echoBodyHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("X-Seen-Signature", r.Header.Get(DefaultHMACHeader))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body) //nolint:errcheck
+})
+
+func newSignedRequest(t *testing.T, method, target, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if err := SignRequest(req, testHMACSecret, ""); err != nil {
+		t.Fatalf("SignRequest() error: %v", err)
+	}
+	return req
+}
+
+func TestRequireHMAC_ValidSignature(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC(testHMACSecret, "")(echoBodyHandler)
+
+	req := newSignedRequest(t, http.MethodPost, "/internal/jobs?x=1", `{"job":"reindex"}`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d (body %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Body.String(); got != `{"job":"reindex"}` {
+		t.Errorf("downstream body = %q; want the original body", got)
+	}
+	if got := rec.Header().Get("X-Seen-Signature"); got != "" {
+		t.Errorf("downstream saw signature header %q; want it stripped", got)
+	}
+}
+
+func TestRequireHMAC_CustomHeader(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC(testHMACSecret, "X-Internal-Sig")(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/internal/health", nil)
+	if err := SignRequest(req, testHMACSecret, "X-Internal-Sig"); err != nil {
+		t.Fatalf("SignRequest() error: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRequireHMAC_TamperedBody(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC(testHMACSecret, "")(okHandler)
+
+	req := newSignedRequest(t, http.MethodPost, "/internal/jobs", `{"job":"reindex"}`)
+	req.Body = io.NopCloser(strings.NewReader(`{"job":"drop-all"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireHMAC_TamperedPath(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC(testHMACSecret, "")(okHandler)
+
+	signed := newSignedRequest(t, http.MethodDelete, "/internal/jobs/1", "")
+	req := httptest.NewRequest(http.MethodDelete, "/internal/jobs/2", nil)
+	req.Header = signed.Header.Clone()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireHMAC_WrongSecret(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC([]byte("other-secret"), "")(okHandler)
+
+	req := newSignedRequest(t, http.MethodGet, "/internal/health", "")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireHMAC_StaleSignature(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC(testHMACSecret, "")(okHandler)
+
+	date := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	req := httptest.NewRequest(http.MethodGet, "/internal/health", nil)
+	req.Header.Set(HMACDateHeader, date)
+	req.Header.Set(DefaultHMACHeader, hex.EncodeToString(hmacSignature(testHMACSecret, http.MethodGet, "/internal/health", date, nil)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if !strings.Contains(rec.Body.String(), "stale signature") {
+		t.Errorf("body = %s; want stale signature", rec.Body.String())
+	}
+}
+
+func TestRequireHMAC_MissingSignature(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.RequireHMAC(testHMACSecret, "")(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/internal/health", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -1,117 +1,402 @@
 package hellojohn
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/ed25519"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// maxJWKSResponseBytes caps the size of a JWKS response body. A legitimate
+// key set is a few kilobytes at most.
+const maxJWKSResponseBytes = 1 << 20
+
+// unknownKidTTL is how long a kid missing from a freshly refreshed key set is
+// remembered, so that repeated tokens naming it do not each attempt a refresh.
+const unknownKidTTL = 30 * time.Second
+
+// maxUnknownKids bounds the remembered unknown kids. When full, the set is
+// emptied rather than evicted entry by entry.
+const maxUnknownKids = 1024
+
+// failedRefreshBackoff is how long a cache serving stale keys waits after a
+// failed refresh before trying the endpoint again.
+const failedRefreshBackoff = 30 * time.Second
+
 type jwksCache struct {
-	mu          sync.RWMutex
-	keys        map[string]ed25519.PublicKey
-	domain      string
+	mu sync.RWMutex
+	// static caches never refresh; see newStaticJWKSCache.
+	static bool
+	// fetching serializes refreshes. It is a channel rather than a mutex so
+	// that callers waiting behind an in-flight fetch still honor their context.
+	fetching chan struct{}
+	keys     map[string]ed25519.PublicKey
+	// unsupported maps kids of published keys that cannot be used to the
+	// reason, so a token naming one gets a clearer error than "not found".
+	unsupported map[string]string
+	// unknownKids records when each kid was last found missing after a
+	// refresh; see unknownKidTTL.
+	unknownKids map[string]time.Time
+	url         string
+	client      *http.Client // nil means defaultHTTPClient
+	headers     map[string]string
 	lastFetch   time.Time
 	ttl         time.Duration
 	minInterval time.Duration
+
+	// staleGrace bounds how long past ttl a cached key may be served while
+	// refreshes fail. Zero means no bound.
+	staleGrace  time.Duration
+	lastFailure time.Time
+}
+
+// jwksURL returns the standard JWKS location for a HelloJohn domain.
+func jwksURL(domain string) string {
+	return domain + "/.well-known/jwks.json"
 }
 
-func newJWKSCache(domain string, ttl time.Duration) *jwksCache {
+// newJWKSCache creates a cache for the JWKS document served at url.
+func newJWKSCache(url string, ttl time.Duration) *jwksCache {
 	return &jwksCache{
+		fetching:    make(chan struct{}, 1),
 		keys:        make(map[string]ed25519.PublicKey),
-		domain:      domain,
+		url:         url,
 		ttl:         ttl,
 		minInterval: 5 * time.Minute,
 	}
 }
 
+// newStaticJWKSCache returns a cache holding a fixed key set that is never
+// refreshed over the network.
+func newStaticJWKSCache(keys map[string]ed25519.PublicKey, unsupported map[string]string) *jwksCache {
+	return &jwksCache{static: true, keys: keys, unsupported: unsupported}
+}
+
+// snapshot returns a static copy of the key set, refreshing it first under
+// the same rules as Keys.
+func (c *jwksCache) snapshot(ctx context.Context) (*jwksCache, error) {
+	if _, err := c.Keys(ctx); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make(map[string]ed25519.PublicKey, len(c.keys))
+	for kid, key := range c.keys {
+		keys[kid] = key
+	}
+	unsupported := make(map[string]string, len(c.unsupported))
+	for kid, reason := range c.unsupported {
+		unsupported[kid] = reason
+	}
+	return newStaticJWKSCache(keys, unsupported), nil
+}
+
 // GetKey returns the Ed25519 public key for the given kid.
 // It transparently refreshes the cache when expired or when a kid is not found.
+//
+// The two failure modes are reported distinctly: ErrInvalidToken when the
+// key set is current but does not contain kid (wrong issuer or forged token),
+// and ErrJWKSFetchFailed when the key set could not be refreshed at all. A
+// failed refresh only ever falls back to a key that was present in the last
+// successful fetch. A kid found missing after a refresh is answered from
+// memory for unknownKidTTL, so a flood of tokens with the same bogus kid
+// costs at most one refresh attempt.
 func (c *jwksCache) GetKey(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	if c.static {
+		if key, ok := c.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, c.missingKeyError(kid)
+	}
+
 	c.mu.RLock()
 	key, ok := c.keys[kid]
-	expired := time.Since(c.lastFetch) > c.ttl
+	age := time.Since(c.lastFetch)
+	recentFailure := time.Since(c.lastFailure) < failedRefreshBackoff
+	recentlyUnknown := !ok && time.Since(c.unknownKids[kid]) < unknownKidTTL
 	c.mu.RUnlock()
 
-	if ok && !expired {
+	if ok && age <= c.ttl {
+		return key, nil
+	}
+
+	// A kid that was missing from the last refresh moments ago will not
+	// appear in another; don't let repeats of it queue up refreshes.
+	if recentlyUnknown {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return nil, c.missingKeyError(kid)
+	}
+
+	// Within the stale grace window, skip the network entirely while the
+	// endpoint is known to be failing.
+	withinGrace := c.staleGrace == 0 || age <= c.ttl+c.staleGrace
+	if ok && c.staleGrace > 0 && withinGrace && recentFailure {
 		return key, nil
 	}
 
 	if err := c.refresh(ctx); err != nil {
-		// If we had a cached key and refresh fails, return the cached key
-		if ok {
+		c.mu.Lock()
+		c.lastFailure = time.Now()
+		c.mu.Unlock()
+
+		// If we had a cached key and refresh fails, return the cached key.
+		// c.keys is replaced wholesale on success, so key is from the last
+		// successful fetch.
+		if ok && withinGrace {
 			return key, nil
 		}
 		return nil, err
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	key, ok = c.keys[kid]
 	if !ok {
-		return nil, fmt.Errorf("%w: key %s not found in JWKS", ErrInvalidToken, kid)
+		if c.unknownKids == nil || len(c.unknownKids) >= maxUnknownKids {
+			c.unknownKids = make(map[string]time.Time)
+		}
+		c.unknownKids[kid] = time.Now()
+		return nil, c.missingKeyError(kid)
 	}
 	return key, nil
 }
 
+// missingKeyError reports a kid that has no usable key, distinguishing keys
+// that are published but unsupported (ErrUnsupportedKey) from absent ones.
+// The caller must hold c.mu or own a static cache.
+func (c *jwksCache) missingKeyError(kid string) error {
+	if reason, ok := c.unsupported[kid]; ok {
+		return fmt.Errorf("%w: %w: key %s: %s", ErrInvalidToken, ErrUnsupportedKey, kid, reason)
+	}
+	return fmt.Errorf("%w: key %s not found in JWKS", ErrInvalidToken, kid)
+}
+
+// Keys returns every key in the set, for tokens without a kid. The cache is
+// refreshed first when it is empty or past its TTL, and a failed refresh
+// falls back to the cached keys under the same rules as GetKey. Keys are
+// returned in kid order.
+func (c *jwksCache) Keys(ctx context.Context) ([]ed25519.PublicKey, error) {
+	if !c.static {
+		c.mu.RLock()
+		n := len(c.keys)
+		age := time.Since(c.lastFetch)
+		recentFailure := time.Since(c.lastFailure) < failedRefreshBackoff
+		c.mu.RUnlock()
+
+		withinGrace := c.staleGrace == 0 || age <= c.ttl+c.staleGrace
+		haveStale := n > 0 && withinGrace
+		skipRefresh := haveStale && c.staleGrace > 0 && recentFailure
+		if (n == 0 || age > c.ttl) && !skipRefresh {
+			if err := c.refresh(ctx); err != nil {
+				c.mu.Lock()
+				c.lastFailure = time.Now()
+				c.mu.Unlock()
+				if !haveStale {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.keys) == 0 {
+		return nil, fmt.Errorf("%w: JWKS contains no usable keys", ErrInvalidToken)
+	}
+	kids := make([]string, 0, len(c.keys))
+	for kid := range c.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	keys := make([]ed25519.PublicKey, len(kids))
+	for i, kid := range kids {
+		keys[i] = c.keys[kid]
+	}
+	return keys, nil
+}
+
+// refresh re-fetches the JWKS unless a fetch happened within minInterval.
+// The HTTP request is bound to ctx, and a cancelled or expired ctx is
+// reported as ErrJWKSFetchFailed wrapping ctx.Err().
 func (c *jwksCache) refresh(ctx context.Context) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	select {
+	case c.fetching <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrJWKSFetchFailed, ctx.Err())
+	}
+	defer func() { <-c.fetching }()
 
 	// Rate limit: don't fetch more often than minInterval
-	if !c.lastFetch.IsZero() && time.Since(c.lastFetch) < c.minInterval {
+	c.mu.RLock()
+	lastFetch := c.lastFetch
+	c.mu.RUnlock()
+	if !lastFetch.IsZero() && time.Since(lastFetch) < c.minInterval {
 		return nil
 	}
 
-	url := fmt.Sprintf("%s/.well-known/jwks.json", c.domain)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	keys, unsupported, err := c.fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrJWKSFetchFailed, err)
+		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	c.mu.Lock()
+	c.keys = keys
+	c.unsupported = unsupported
+	c.lastFetch = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// fetch downloads and parses the JWKS document.
+func (c *jwksCache) fetch(ctx context.Context) (map[string]ed25519.PublicKey, map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrJWKSFetchFailed, err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrJWKSFetchFailed, err)
+	}
+	setExtraHeaders(req, c.headers)
+	setRequestID(req)
+	// Asking for gzip explicitly disables the transport's transparent
+	// decompression, so decoding is handled below regardless of transport.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := httpClientOrDefault(c.client).Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrJWKSFetchFailed, ctxErr)
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrJWKSFetchFailed, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: HTTP %d from JWKS endpoint", ErrJWKSFetchFailed, resp.StatusCode)
+		return nil, nil, fmt.Errorf("%w: HTTP %d from JWKS endpoint", ErrJWKSFetchFailed, resp.StatusCode)
+	}
+
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid gzip body: %v", ErrJWKSFetchFailed, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	// The limit applies to the decompressed size.
+	body, err := io.ReadAll(io.LimitReader(reader, maxJWKSResponseBytes+1))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrJWKSFetchFailed, ctxErr)
+		}
+		return nil, nil, fmt.Errorf("%w: failed to read JWKS: %v", ErrJWKSFetchFailed, err)
+	}
+	if len(body) > maxJWKSResponseBytes {
+		return nil, nil, fmt.Errorf("%w: JWKS response too large", ErrJWKSFetchFailed)
 	}
 
+	// Servers that omit Content-Type get text/plain from sniffing, so the
+	// media type alone is not decisive; a misconfigured proxy's HTML error
+	// page is caught by also looking at the body.
+	contentType := resp.Header.Get("Content-Type")
+	if !isJSONMediaType(contentType) && !looksLikeJSON(body) {
+		return nil, nil, fmt.Errorf("%w: unexpected Content-Type %q, body starts %q",
+			ErrJWKSFetchFailed, contentType, bodySnippet(body))
+	}
+
+	keys, unsupported, err := parseJWKS(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrJWKSFetchFailed, err)
+	}
+	return keys, unsupported, nil
+}
+
+// jwksErrorSnippetBytes is how much of an unexpected JWKS body is quoted in
+// the error.
+const jwksErrorSnippetBytes = 64
+
+// isJSONMediaType reports whether contentType is application/json or a
+// +json structured syntax type such as application/jwk-set+json.
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// looksLikeJSON reports whether body starts like a JSON object.
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func bodySnippet(body []byte) string {
+	if len(body) > jwksErrorSnippetBytes {
+		body = body[:jwksErrorSnippetBytes]
+	}
+	return string(body)
+}
+
+// parseJWKS extracts the Ed25519 keys from a JWKS document. Keys of other
+// types, keys declaring an alg other than EdDSA and keys without a kid are
+// ignored. OKP keys that are meant for EdDSA but cannot be used, such as
+// Ed448 keys or malformed Ed25519 keys, are returned in unsupported with the
+// reason.
+func parseJWKS(data []byte) (keys map[string]ed25519.PublicKey, unsupported map[string]string, err error) {
 	var jwks struct {
 		Keys []json.RawMessage `json:"keys"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
-		return fmt.Errorf("%w: failed to decode JWKS: %v", ErrJWKSFetchFailed, err)
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode JWKS: %v", err)
 	}
 
 	newKeys := make(map[string]ed25519.PublicKey)
+	unsupported = make(map[string]string)
 	for _, raw := range jwks.Keys {
 		var header struct {
 			Kid string `json:"kid"`
 			Kty string `json:"kty"`
+			Alg string `json:"alg"`
 			Crv string `json:"crv"`
 			X   string `json:"x"`
 		}
 		if err := json.Unmarshal(raw, &header); err != nil {
 			continue
 		}
-		if header.Kty == "OKP" && header.Crv == "Ed25519" && header.Kid != "" {
+		// A key that declares an alg other than EdDSA is not for us.
+		if header.Alg != "" && header.Alg != "EdDSA" {
+			continue
+		}
+		if header.Kty != "OKP" || header.Kid == "" {
+			continue
+		}
+		switch header.Crv {
+		case "Ed25519":
 			pubKey, err := decodeEd25519PublicKey(header.X)
-			if err == nil {
-				newKeys[header.Kid] = pubKey
+			if err != nil {
+				unsupported[header.Kid] = err.Error()
+				continue
 			}
+			newKeys[header.Kid] = pubKey
+		case "Ed448":
+			// The standard library has no Ed448 and the SDK takes no
+			// dependencies, so Ed448 keys are recognized but not usable.
+			unsupported[header.Kid] = "Ed448 keys are not supported"
 		}
 	}
 
-	c.keys = newKeys
-	c.lastFetch = time.Now()
-	return nil
+	return newKeys, unsupported, nil
 }
 
 // decodeEd25519PublicKey decodes a base64url-encoded Ed25519 public key (the "x" parameter from JWK).
@@ -0,0 +1,529 @@
+package hellojohn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKSRefresh_ResponseTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"keys":[],"pad":"`))                        //nolint:errcheck
+		w.Write([]byte(strings.Repeat("a", maxJWKSResponseBytes+1))) //nolint:errcheck
+		w.Write([]byte(`"}`))                                        //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	_, err := cache.GetKey(context.Background(), "any")
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Fatalf("GetKey() error = %v; want ErrJWKSFetchFailed", err)
+	}
+	if !strings.Contains(err.Error(), "too large") {
+		t.Errorf("GetKey() error = %q; want it to mention too large", err)
+	}
+}
+
+func TestJWKSRefresh_GzipEncoded(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(testJWKS(pub)) //nolint:errcheck
+	gz.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes()) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	key, err := cache.GetKey(context.Background(), testKID)
+	if err != nil {
+		t.Fatalf("GetKey() error: %v", err)
+	}
+	if !key.Equal(pub) {
+		t.Error("GetKey() returned a key that does not match the published key")
+	}
+}
+
+func TestJWKSRefresh_HTMLResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<!DOCTYPE html><html><body><h1>502 Bad Gateway</h1>" + strings.Repeat("x", 200) + "</body></html>")) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	_, err := cache.GetKey(context.Background(), testKID)
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Fatalf("GetKey() error = %v; want ErrJWKSFetchFailed", err)
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "text/html") || !strings.Contains(msg, "502 Bad Gateway") {
+		t.Errorf("error = %q; want content type and body snippet", msg)
+	}
+	if strings.Contains(msg, "</body>") {
+		t.Errorf("error = %q; want body truncated", msg)
+	}
+}
+
+func TestJWKSRefresh_UntypedJSONAccepted(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(testJWKS(pub)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Fatalf("GetKey() error: %v", err)
+	}
+}
+
+func TestJWKSRefresh_InvalidGzip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(`{"keys":[]}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	_, err := cache.GetKey(context.Background(), testKID)
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("GetKey() error = %v; want ErrJWKSFetchFailed", err)
+	}
+}
+
+func TestJWKSRefresh_LoadsEd25519Key(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	key, err := cache.GetKey(context.Background(), testKID)
+	if err != nil {
+		t.Fatalf("GetKey() error: %v", err)
+	}
+	if !key.Equal(priv.Public()) {
+		t.Error("GetKey() returned a key that does not match the published key")
+	}
+}
+
+// newBlockingJWKSServer returns a server whose handler blocks until the client
+// goes away or the test ends.
+func newBlockingJWKSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestJWKSRefresh_HonorsContextDeadline(t *testing.T) {
+	srv := newBlockingJWKSServer(t)
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cache.GetKey(ctx, "any")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("GetKey() took %v; want it to abort at the context deadline", elapsed)
+	}
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("GetKey() error = %v; want ErrJWKSFetchFailed", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetKey() error = %v; want it to wrap context.DeadlineExceeded", err)
+	}
+}
+
+func TestJWKSRefresh_WaiterHonorsOwnContext(t *testing.T) {
+	srv := newBlockingJWKSServer(t)
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+
+	// Occupy the fetch slot with a long-running refresh.
+	slowCtx, cancelSlow := context.WithCancel(context.Background())
+	defer cancelSlow()
+	done := make(chan struct{})
+	go func() {
+		cache.GetKey(slowCtx, "any") //nolint:errcheck
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cache.GetKey(ctx, "any")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("GetKey() took %v; want it to abort at the context deadline", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetKey() error = %v; want it to wrap context.DeadlineExceeded", err)
+	}
+
+	cancelSlow()
+	<-done
+}
+
+func TestJWKSRefresh_CancelledContextDoesNotUpdateLastFetch(t *testing.T) {
+	srv := newBlockingJWKSServer(t)
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := cache.GetKey(ctx, "any"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetKey() error = %v; want it to wrap context.Canceled", err)
+	}
+	if !cache.lastFetch.IsZero() {
+		t.Error("lastFetch was set by a cancelled fetch; the next caller would be rate limited")
+	}
+}
+
+// newFlakyJWKSServer publishes a fresh key under testKID while *up is true and
+// answers 503 otherwise.
+func newFlakyJWKSServer(t *testing.T, up *atomic.Bool) (*httptest.Server, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(testJWKS(pub)) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, priv
+}
+
+func TestGetKey_UnknownKidIsInvalidToken(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	srv, _ := newFlakyJWKSServer(t, &up)
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	_, err := cache.GetKey(context.Background(), "unknown-kid")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("GetKey() error = %v; want ErrInvalidToken", err)
+	}
+	if errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("GetKey() error = %v; must not be ErrJWKSFetchFailed", err)
+	}
+}
+
+func TestGetKey_RepeatedUnknownKidRefreshesOnce(t *testing.T) {
+	srv, _, fetches := newCountingJWKSServer(t)
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	// Without the rate limit every refresh attempt reaches the server.
+	cache.minInterval = 0
+
+	for i := 0; i < 100; i++ {
+		if _, err := cache.GetKey(context.Background(), "unknown-kid"); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("GetKey() error = %v; want ErrInvalidToken", err)
+		}
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("JWKS fetches = %d; want 1", n)
+	}
+
+	// A different new kid is still looked up.
+	cache.GetKey(context.Background(), "other-kid") //nolint:errcheck
+	if n := atomic.LoadInt32(fetches); n != 2 {
+		t.Errorf("JWKS fetches after a new kid = %d; want 2", n)
+	}
+
+	// Once the entry expires the kid is looked up again.
+	cache.mu.Lock()
+	cache.unknownKids["unknown-kid"] = time.Now().Add(-unknownKidTTL)
+	cache.mu.Unlock()
+	cache.GetKey(context.Background(), "unknown-kid") //nolint:errcheck
+	if n := atomic.LoadInt32(fetches); n != 3 {
+		t.Errorf("JWKS fetches after expiry = %d; want 3", n)
+	}
+}
+
+func TestGetKey_EndpointDownIsFetchFailed(t *testing.T) {
+	var up atomic.Bool
+	srv, _ := newFlakyJWKSServer(t, &up)
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	_, err := cache.GetKey(context.Background(), testKID)
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("GetKey() error = %v; want ErrJWKSFetchFailed", err)
+	}
+	if errors.Is(err, ErrInvalidToken) {
+		t.Errorf("GetKey() error = %v; must not be ErrInvalidToken", err)
+	}
+}
+
+func TestGetKey_StaleFallbackOnlyForKnownKid(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	srv, _ := newFlakyJWKSServer(t, &up)
+
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Fatalf("GetKey() error: %v", err)
+	}
+
+	// Expire the cache and take the endpoint down.
+	up.Store(false)
+	cache.mu.Lock()
+	cache.lastFetch = time.Now().Add(-2 * time.Hour)
+	cache.mu.Unlock()
+
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Errorf("GetKey(known kid) error = %v; want stale cached key", err)
+	}
+	_, err := cache.GetKey(context.Background(), "rotated-kid")
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("GetKey(unknown kid) error = %v; want ErrJWKSFetchFailed", err)
+	}
+}
+
+func TestVerify_DistinguishesUnknownKidFromFetchFailure(t *testing.T) {
+	var up atomic.Bool
+	srv, priv := newFlakyJWKSServer(t, &up)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1"})
+
+	_, err = c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("VerifyToken() with endpoint down error = %v; want ErrJWKSFetchFailed", err)
+	}
+
+	up.Store(true)
+	unknown := signTestTokenWithKID(t, priv, "unknown-kid", map[string]interface{}{"sub": "user-1"})
+	_, err = c.VerifyToken(context.Background(), unknown)
+	if !errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("VerifyToken() with unknown kid error = %v; want ErrInvalidToken only", err)
+	}
+}
+
+// newGraceTestCache returns a warm cache for a flaky server that has since
+// gone down, with its last successful fetch age past the TTL.
+func newGraceTestCache(t *testing.T, grace, age time.Duration) (*jwksCache, *countingTransport) {
+	t.Helper()
+	var up atomic.Bool
+	up.Store(true)
+	srv, _ := newFlakyJWKSServer(t, &up)
+
+	tr := &countingTransport{next: DefaultTransport()}
+	cache := newJWKSCache(jwksURL(srv.URL), time.Hour)
+	cache.client = &http.Client{Transport: tr}
+	cache.staleGrace = grace
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Fatalf("GetKey() error: %v", err)
+	}
+
+	up.Store(false)
+	cache.mu.Lock()
+	cache.lastFetch = time.Now().Add(-age)
+	cache.mu.Unlock()
+	return cache, tr
+}
+
+func TestGetKey_StaleWithinGrace(t *testing.T) {
+	cache, tr := newGraceTestCache(t, 10*time.Minute, time.Hour+5*time.Minute)
+
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Fatalf("GetKey() within grace error = %v; want stale key", err)
+	}
+	// The failure is remembered; the next lookup does not hit the endpoint.
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Fatalf("second GetKey() within grace error = %v; want stale key", err)
+	}
+	if n := atomic.LoadInt32(&tr.calls); n != 2 {
+		t.Errorf("JWKS requests = %d; want 2 (initial fetch + one failed refresh)", n)
+	}
+}
+
+func TestGetKey_StaleBeyondGrace(t *testing.T) {
+	cache, _ := newGraceTestCache(t, 10*time.Minute, time.Hour+20*time.Minute)
+
+	_, err := cache.GetKey(context.Background(), testKID)
+	if !errors.Is(err, ErrJWKSFetchFailed) {
+		t.Errorf("GetKey() beyond grace error = %v; want ErrJWKSFetchFailed", err)
+	}
+}
+
+func TestGetKey_NoGraceServesStaleIndefinitely(t *testing.T) {
+	cache, _ := newGraceTestCache(t, 0, 24*time.Hour)
+
+	if _, err := cache.GetKey(context.Background(), testKID); err != nil {
+		t.Errorf("GetKey() without grace bound error = %v; want stale key", err)
+	}
+}
+
+// ed448JWKS returns a JWKS document with an Ed25519 key (kid "ed25519") and
+// an Ed448 key (kid "ed448"), and the Ed25519 private key.
+func ed448JWKS(t *testing.T) ([]byte, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	ed448X := base64.RawURLEncoding.EncodeToString(make([]byte, 57))
+	doc, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "OKP", "crv": "Ed448", "kid": "ed448", "alg": "EdDSA", "x": ed448X},
+			{"kty": "OKP", "crv": "Ed25519", "kid": "ed25519", "alg": "EdDSA", "x": base64.RawURLEncoding.EncodeToString(pub)},
+		},
+	})
+	return doc, priv
+}
+
+func TestParseJWKS_Ed448KeyUnsupported(t *testing.T) {
+	doc, _ := ed448JWKS(t)
+	keys, unsupported, err := parseJWKS(doc)
+	if err != nil {
+		t.Fatalf("parseJWKS() error: %v", err)
+	}
+	if _, ok := keys["ed25519"]; !ok || len(keys) != 1 {
+		t.Errorf("keys = %v; want only ed25519", keys)
+	}
+	if _, ok := unsupported["ed448"]; !ok {
+		t.Errorf("unsupported = %v; want ed448", unsupported)
+	}
+}
+
+func TestVerify_Ed448KeyReportsUnsupported(t *testing.T) {
+	doc, priv := ed448JWKS(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}))
+	t.Cleanup(srv.Close)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	payload := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+
+	if _, err := c.VerifyToken(context.Background(), signTestTokenWithKID(t, priv, "ed25519", payload)); err != nil {
+		t.Errorf("Ed25519 token: VerifyToken() error: %v", err)
+	}
+
+	_, err = c.VerifyToken(context.Background(), signTestTokenWithKID(t, priv, "ed448", payload))
+	if !errors.Is(err, ErrUnsupportedKey) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Ed448 token: err = %v; want ErrInvalidToken and ErrUnsupportedKey", err)
+	}
+
+	_, err = VerifyWithJWKS(context.Background(), signTestTokenWithKID(t, priv, "ed448", payload), doc)
+	if !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("VerifyWithJWKS: err = %v; want ErrUnsupportedKey", err)
+	}
+}
+
+func TestVerify_UnknownKidNotReportedUnsupported(t *testing.T) {
+	doc, priv := ed448JWKS(t)
+	payload := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	_, err := VerifyWithJWKS(context.Background(), signTestTokenWithKID(t, priv, "other", payload), doc)
+	if !errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("err = %v; want ErrInvalidToken only", err)
+	}
+}
+
+func TestJWKSRefresh_ExtraHeaders(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testJWKS(pub))
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := New(Config{
+		Domain:       srv.URL,
+		ExtraHeaders: map[string]string{"X-Api-Key": "k-123", "Accept-Encoding": "br"},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+
+	if v := got.Get("X-Api-Key"); v != "k-123" {
+		t.Errorf("X-Api-Key = %q; want k-123", v)
+	}
+	if v := got.Get("Accept-Encoding"); v != "gzip" {
+		t.Errorf("Accept-Encoding = %q; want the SDK's gzip", v)
+	}
+}
+
+func TestJWKSRefresh_RequestID(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testJWKS(pub))
+	}))
+	t.Cleanup(srv.Close)
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"with ID", ContextWithRequestID(context.Background(), "req-42"), "req-42"},
+		{"without ID", context.Background(), ""},
+	}
+	for _, tt := range tests {
+		// A fresh client per case so each verification fetches.
+		c, err := New(Config{Domain: srv.URL})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		if _, err := c.VerifyToken(tt.ctx, token); err != nil {
+			t.Fatalf("%s: VerifyToken() error: %v", tt.name, err)
+		}
+		if v, ok := got["X-Request-Id"]; tt.want == "" && ok {
+			t.Errorf("%s: X-Request-Id = %q; want none", tt.name, v)
+		}
+		if v := got.Get("X-Request-Id"); v != tt.want {
+			t.Errorf("%s: X-Request-Id = %q; want %q", tt.name, v, tt.want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,18 +26,114 @@ type M2MConfig struct {
 
 	// ClientSecret is the client secret. Required.
 	ClientSecret string
+
+	// HTTPClient is used for token requests. Default: a client built on
+	// DefaultTransport with a 10 second timeout.
+	HTTPClient *http.Client
+
+	// Cache stores issued tokens. It may be shared between M2MClients; keys
+	// include the domain, tenant, client ID and scopes, so clients with
+	// identical settings share tokens and others never collide. Default: an
+	// unbounded in-memory map private to the client.
+	Cache TokenCache
+
+	// RequireBearerTokenType makes GetToken fail with ErrM2MAuthFailed when
+	// the response's token_type is not Bearer (compared case-insensitively),
+	// e.g. a DPoP-bound token that must not be sent as a bearer token.
+	RequireBearerTokenType bool
+
+	// ExtraHeaders are added to every token request, e.g. an API key required
+	// by a gateway in front of the auth server. They cannot replace the
+	// Content-Type or X-Tenant-Slug headers the client sets itself.
+	// Optional.
+	ExtraHeaders map[string]string
+
+	// DefaultScopes are requested with every token. A TokenRequest's Scopes
+	// are added to them, without duplicates. Optional.
+	DefaultScopes []string
+}
+
+// CachedToken is an access token held in a TokenCache.
+type CachedToken struct {
+	AccessToken string
+	TokenType   string
+	ExpiresAt   int64 // Unix timestamp
+}
+
+// TokenCache stores M2M access tokens by key. Implementations must be safe
+// for concurrent use. Expiry is checked by the M2MClient, so a cache may
+// return expired tokens.
+type TokenCache interface {
+	Get(key string) (*CachedToken, bool)
+	Set(key string, token *CachedToken)
+	Delete(key string)
+	Clear()
 }
 
-type cachedToken struct {
-	accessToken string
-	expiresAt   int64 // Unix timestamp
+// memoryTokenCache is the default TokenCache.
+type memoryTokenCache struct {
+	mu     sync.RWMutex
+	tokens map[string]*CachedToken
+}
+
+// NewMemoryTokenCache returns an unbounded, concurrency-safe in-memory
+// TokenCache, suitable for sharing between M2MClients in one process.
+func NewMemoryTokenCache() TokenCache {
+	return &memoryTokenCache{tokens: make(map[string]*CachedToken)}
+}
+
+func (m *memoryTokenCache) Get(key string) (*CachedToken, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tokens[key]
+	return t, ok
+}
+
+func (m *memoryTokenCache) Set(key string, token *CachedToken) {
+	m.mu.Lock()
+	m.tokens[key] = token
+	m.mu.Unlock()
+}
+
+func (m *memoryTokenCache) Delete(key string) {
+	m.mu.Lock()
+	delete(m.tokens, key)
+	m.mu.Unlock()
+}
+
+func (m *memoryTokenCache) Clear() {
+	m.mu.Lock()
+	m.tokens = make(map[string]*CachedToken)
+	m.mu.Unlock()
+}
+
+func (m *memoryTokenCache) len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.tokens)
 }
 
 // M2MClient handles machine-to-machine authentication via client_credentials grant.
 type M2MClient struct {
 	config M2MConfig
-	mu     sync.RWMutex
-	cache  map[string]*cachedToken
+	cache  TokenCache
+
+	// cacheHits and cacheMisses count GetToken calls served from the cache
+	// and those that were not, for Client.DebugHandler.
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+
+	// inflight coalesces concurrent token requests per cache key.
+	mu       sync.Mutex
+	inflight map[string]*tokenCall
+}
+
+// tokenCall is a token request shared by every caller that needs the same
+// cache key while it is in flight. result and err are set before done closes.
+type tokenCall struct {
+	done   chan struct{}
+	result *TokenResult
+	err    error
 }
 
 // TokenRequest specifies the scopes for an M2M token request.
@@ -47,7 +144,42 @@ type TokenRequest struct {
 // TokenResult contains the M2M access token and its expiration.
 type TokenResult struct {
 	AccessToken string
-	ExpiresAt   int64
+	// TokenType is the token_type from the token response, e.g. "Bearer".
+	TokenType string
+	ExpiresAt int64
+}
+
+// M2MError is the RFC 6749 error response returned by the token endpoint.
+// GetToken returns it when the endpoint rejects the request with an error
+// code; it wraps ErrM2MAuthFailed:
+//
+//	var m2mErr *hellojohn.M2MError
+//	if errors.As(err, &m2mErr) && m2mErr.Code == "invalid_client" { ... }
+type M2MError struct {
+	// Code is the error field, e.g. "invalid_client" or "invalid_scope".
+	Code string
+
+	// Description is the error_description field, empty if absent.
+	Description string
+
+	// URI is the error_uri field, empty if absent.
+	URI string
+}
+
+func (e *M2MError) Error() string {
+	msg := ErrM2MAuthFailed.Error() + ": " + e.Code
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.URI != "" {
+		msg += " (" + e.URI + ")"
+	}
+	return msg
+}
+
+// Unwrap returns ErrM2MAuthFailed.
+func (e *M2MError) Unwrap() error {
+	return ErrM2MAuthFailed
 }
 
 // NewM2MClient creates a new M2M client for service-to-service authentication.
@@ -62,32 +194,81 @@ func NewM2MClient(cfg M2MConfig) (*M2MClient, error) {
 		return nil, fmt.Errorf("hellojohn: m2m clientSecret is required")
 	}
 	cfg.Domain = strings.TrimRight(cfg.Domain, "/")
+	if cfg.Cache == nil {
+		cfg.Cache = NewMemoryTokenCache()
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = newDefaultHTTPClient()
+	}
 
 	return &M2MClient{
-		config: cfg,
-		cache:  make(map[string]*cachedToken),
+		config:   cfg,
+		cache:    cfg.Cache,
+		inflight: make(map[string]*tokenCall),
 	}, nil
 }
 
 // GetToken retrieves an access token via client_credentials grant.
 // Tokens are cached until 60 seconds before expiry.
+//
+// Concurrent calls for the same scopes share one token request. The shared
+// request is not cancelled with any single caller's ctx; a caller whose ctx
+// ends stops waiting and gets ctx.Err() while the others still receive the
+// token.
 func (c *M2MClient) GetToken(ctx context.Context, req TokenRequest) (*TokenResult, error) {
-	scopeKey := buildScopeKey(req.Scopes)
+	req.Scopes = unionStrings(c.config.DefaultScopes, req.Scopes)
+	cacheKey := c.cacheKey(req.Scopes)
 
 	// Check cache
-	c.mu.RLock()
-	cached, ok := c.cache[scopeKey]
-	c.mu.RUnlock()
+	cached, ok := c.cache.Get(cacheKey)
 
 	now := time.Now().Unix()
-	if ok && cached.expiresAt > now+60 {
+	if ok && cached != nil && cached.ExpiresAt > now+60 {
+		c.cacheHits.Add(1)
 		return &TokenResult{
-			AccessToken: cached.accessToken,
-			ExpiresAt:   cached.expiresAt,
+			AccessToken: cached.AccessToken,
+			TokenType:   cached.TokenType,
+			ExpiresAt:   cached.ExpiresAt,
 		}, nil
 	}
+	c.cacheMisses.Add(1)
+
+	c.mu.Lock()
+	call, ok := c.inflight[cacheKey]
+	if !ok {
+		call = &tokenCall{done: make(chan struct{})}
+		c.inflight[cacheKey] = call
+		go c.runTokenCall(context.WithoutCancel(ctx), cacheKey, req, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		result := *call.result
+		return &result, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrM2MAuthFailed, ctx.Err())
+	}
+}
+
+// runTokenCall performs call's token request and publishes the result to
+// every waiter.
+func (c *M2MClient) runTokenCall(ctx context.Context, cacheKey string, req TokenRequest, call *tokenCall) {
+	call.result, call.err = c.requestToken(ctx, cacheKey, req)
+
+	c.mu.Lock()
+	delete(c.inflight, cacheKey)
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// requestToken fetches a new token from the token endpoint and caches it.
+func (c *M2MClient) requestToken(ctx context.Context, cacheKey string, req TokenRequest) (*TokenResult, error) {
+	now := time.Now().Unix()
 
-	// Request new token
 	form := url.Values{
 		"grant_type":    {"client_credentials"},
 		"client_id":     {c.config.ClientID},
@@ -102,12 +283,14 @@ func (c *M2MClient) GetToken(ctx context.Context, req TokenRequest) (*TokenResul
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrM2MAuthFailed, err)
 	}
+	setExtraHeaders(httpReq, c.config.ExtraHeaders)
+	setRequestID(httpReq)
 	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	if c.config.TenantID != "" {
 		httpReq.Header.Set("X-Tenant-Slug", c.config.TenantID)
 	}
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := c.config.HTTPClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrM2MAuthFailed, err)
 	}
@@ -115,50 +298,79 @@ func (c *M2MClient) GetToken(ctx context.Context, req TokenRequest) (*TokenResul
 
 	if resp.StatusCode != http.StatusOK {
 		var errBody struct {
-			Error string `json:"error"`
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+			ErrorURI         string `json:"error_uri"`
 		}
 		json.NewDecoder(resp.Body).Decode(&errBody) //nolint:errcheck
-		msg := errBody.Error
-		if msg == "" {
-			msg = resp.Status
+		if errBody.Error == "" {
+			return nil, fmt.Errorf("%w: %s", ErrM2MAuthFailed, resp.Status)
+		}
+		return nil, &M2MError{
+			Code:        errBody.Error,
+			Description: errBody.ErrorDescription,
+			URI:         errBody.ErrorURI,
 		}
-		return nil, fmt.Errorf("%w: %s", ErrM2MAuthFailed, msg)
 	}
 
 	var tokenResp struct {
 		AccessToken string `json:"access_token"`
-		ExpiresIn   int64  `json:"expires_in"`
-		Scope       string `json:"scope"`
+		TokenType   string `json:"token_type"`
+		// json.Number also accepts a numeric string, which some
+		// non-compliant endpoints send.
+		ExpiresIn json.Number `json:"expires_in"`
+		Scope     string      `json:"scope"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
 		return nil, fmt.Errorf("%w: failed to decode response: %v", ErrM2MAuthFailed, err)
 	}
+	if c.config.RequireBearerTokenType && !strings.EqualFold(tokenResp.TokenType, "Bearer") {
+		return nil, fmt.Errorf("%w: unexpected token_type %q, want Bearer", ErrM2MAuthFailed, tokenResp.TokenType)
+	}
 
-	expiresIn := tokenResp.ExpiresIn
+	expiresIn := toInt64OrZero(tokenResp.ExpiresIn)
 	if expiresIn == 0 {
 		expiresIn = 3600
 	}
 	expiresAt := now + expiresIn
 
-	// Cache token
-	c.mu.Lock()
-	c.cache[scopeKey] = &cachedToken{
-		accessToken: tokenResp.AccessToken,
-		expiresAt:   expiresAt,
+	// Another client sharing the cache may have stored a token while this
+	// request was in flight. Keep whichever lasts longer, so a slow response
+	// cannot replace a fresher token with an older one. Without an atomic
+	// compare-and-set in TokenCache this narrows the window rather than
+	// closing it.
+	if cur, ok := c.cache.Get(cacheKey); ok && cur != nil && cur.ExpiresAt > expiresAt {
+		return &TokenResult{
+			AccessToken: cur.AccessToken,
+			TokenType:   cur.TokenType,
+			ExpiresAt:   cur.ExpiresAt,
+		}, nil
 	}
-	c.mu.Unlock()
+
+	// Cache token
+	c.cache.Set(cacheKey, &CachedToken{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+		ExpiresAt:   expiresAt,
+	})
 
 	return &TokenResult{
 		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
 		ExpiresAt:   expiresAt,
 	}, nil
 }
 
-// ClearCache removes all cached tokens.
+// ClearCache removes all cached tokens. With a shared M2MConfig.Cache this
+// clears the tokens of every client using it.
 func (c *M2MClient) ClearCache() {
-	c.mu.Lock()
-	c.cache = make(map[string]*cachedToken)
-	c.mu.Unlock()
+	c.cache.Clear()
+}
+
+// cacheKey identifies a token by everything that determines what the server
+// issues, so a shared cache never hands one client another's token.
+func (c *M2MClient) cacheKey(scopes []string) string {
+	return strings.Join([]string{c.config.Domain, c.config.TenantID, c.config.ClientID, buildScopeKey(scopes)}, "\n")
 }
 
 func buildScopeKey(scopes []string) string {
@@ -3,10 +3,15 @@ package hellojohn
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // --- NewM2MClient validation tests ---
@@ -398,6 +403,50 @@ func TestGetToken_ErrorOnNon200(t *testing.T) {
 	}
 }
 
+func TestGetToken_ErrorBodyFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":             "invalid_scope",
+			"error_description": "scope admin is not allowed",
+			"error_uri":         "https://docs.example.com/errors#invalid_scope",
+		})
+	}))
+	defer srv.Close()
+
+	client, err := NewM2MClient(M2MConfig{
+		Domain:       srv.URL,
+		ClientID:     "my-client",
+		ClientSecret: "my-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+
+	_, err = client.GetToken(context.Background(), TokenRequest{Scopes: []string{"admin"}})
+	if !errors.Is(err, ErrM2MAuthFailed) {
+		t.Fatalf("GetToken() error = %v; want ErrM2MAuthFailed", err)
+	}
+	var m2mErr *M2MError
+	if !errors.As(err, &m2mErr) {
+		t.Fatalf("GetToken() error = %T; want *M2MError", err)
+	}
+	if m2mErr.Code != "invalid_scope" {
+		t.Errorf("Code = %q; want invalid_scope", m2mErr.Code)
+	}
+	if m2mErr.Description != "scope admin is not allowed" {
+		t.Errorf("Description = %q", m2mErr.Description)
+	}
+	if m2mErr.URI != "https://docs.example.com/errors#invalid_scope" {
+		t.Errorf("URI = %q", m2mErr.URI)
+	}
+	want := "hellojohn: m2m auth failed: invalid_scope: scope admin is not allowed (https://docs.example.com/errors#invalid_scope)"
+	if err.Error() != want {
+		t.Errorf("Error() = %q; want %q", err.Error(), want)
+	}
+}
+
 func TestGetToken_ErrorOn500(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -571,3 +620,489 @@ func TestGetToken_DifferentScopesDifferentCacheEntries(t *testing.T) {
 		t.Errorf("tokens for different scopes should differ: both = %q", r1.AccessToken)
 	}
 }
+
+// --- Shared TokenCache ---
+
+// recordingTokenCache is a custom TokenCache that records the keys it is asked for.
+type recordingTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*CachedToken
+	gets   []string
+}
+
+func newRecordingTokenCache() *recordingTokenCache {
+	return &recordingTokenCache{tokens: make(map[string]*CachedToken)}
+}
+
+func (r *recordingTokenCache) Get(key string) (*CachedToken, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gets = append(r.gets, key)
+	t, ok := r.tokens[key]
+	return t, ok
+}
+
+func (r *recordingTokenCache) Set(key string, token *CachedToken) {
+	r.mu.Lock()
+	r.tokens[key] = token
+	r.mu.Unlock()
+}
+
+func (r *recordingTokenCache) Delete(key string) {
+	r.mu.Lock()
+	delete(r.tokens, key)
+	r.mu.Unlock()
+}
+
+func (r *recordingTokenCache) Clear() {
+	r.mu.Lock()
+	r.tokens = make(map[string]*CachedToken)
+	r.mu.Unlock()
+}
+
+func newCountingTokenServer(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"access_token": fmt.Sprintf("token-%d", n),
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetToken_SharedCacheBetweenClients(t *testing.T) {
+	var calls int32
+	srv := newCountingTokenServer(t, &calls)
+	cache := newRecordingTokenCache()
+
+	cfg := M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret", Cache: cache}
+	a, err := NewM2MClient(cfg)
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+	b, err := NewM2MClient(cfg)
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+
+	ctx := context.Background()
+	ta, err := a.GetToken(ctx, TokenRequest{Scopes: []string{"read", "write"}})
+	if err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	tb, err := b.GetToken(ctx, TokenRequest{Scopes: []string{"write", "read"}})
+	if err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("server called %d times; want 1 (second client should use shared cache)", calls)
+	}
+	if ta.AccessToken != tb.AccessToken {
+		t.Errorf("tokens differ: %q vs %q", ta.AccessToken, tb.AccessToken)
+	}
+	// a: lookup and the re-read before storing; b: lookup.
+	if len(cache.gets) != 3 {
+		t.Errorf("custom cache Get called %d times; want 3", len(cache.gets))
+	}
+}
+
+func TestGetToken_SharedCacheIsolatesClientIDs(t *testing.T) {
+	var calls int32
+	srv := newCountingTokenServer(t, &calls)
+	cache := NewMemoryTokenCache()
+
+	a, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc-a", ClientSecret: "secret", Cache: cache})
+	b, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc-b", ClientSecret: "secret", Cache: cache})
+
+	ctx := context.Background()
+	ta, err := a.GetToken(ctx, TokenRequest{})
+	if err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	tb, err := b.GetToken(ctx, TokenRequest{})
+	if err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("server called %d times; want 2 (different client IDs)", calls)
+	}
+	if ta.AccessToken == tb.AccessToken {
+		t.Errorf("clients with different IDs shared token %q", ta.AccessToken)
+	}
+}
+
+func TestClearCache_UsesConfiguredCache(t *testing.T) {
+	var calls int32
+	srv := newCountingTokenServer(t, &calls)
+	cache := newRecordingTokenCache()
+	client, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret", Cache: cache})
+
+	if _, err := client.GetToken(context.Background(), TokenRequest{}); err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	client.ClearCache()
+	if len(cache.tokens) != 0 {
+		t.Errorf("custom cache holds %d tokens after ClearCache; want 0", len(cache.tokens))
+	}
+}
+
+// --- token_type ---
+
+func newTokenTypeServer(t *testing.T, tokenType string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"access_token": "tok",
+			"token_type":   tokenType,
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetToken_TokenType(t *testing.T) {
+	tests := []struct {
+		tokenType string
+		require   bool
+		wantErr   bool
+	}{
+		{"Bearer", true, false},
+		{"bearer", true, false},
+		{"DPoP", true, true},
+		{"DPoP", false, false},
+		{"", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/require=%v", tt.tokenType, tt.require), func(t *testing.T) {
+			srv := newTokenTypeServer(t, tt.tokenType)
+			client, err := NewM2MClient(M2MConfig{
+				Domain:                 srv.URL,
+				ClientID:               "svc",
+				ClientSecret:           "secret",
+				RequireBearerTokenType: tt.require,
+			})
+			if err != nil {
+				t.Fatalf("NewM2MClient() error: %v", err)
+			}
+
+			result, err := client.GetToken(context.Background(), TokenRequest{})
+			if tt.wantErr {
+				if !errors.Is(err, ErrM2MAuthFailed) {
+					t.Errorf("GetToken() error = %v; want ErrM2MAuthFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetToken() error: %v", err)
+			}
+			if result.TokenType != tt.tokenType {
+				t.Errorf("TokenType = %q; want %q", result.TokenType, tt.tokenType)
+			}
+		})
+	}
+}
+
+func TestGetToken_TokenTypeFromCache(t *testing.T) {
+	srv := newTokenTypeServer(t, "Bearer")
+	client, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret"})
+	client.GetToken(context.Background(), TokenRequest{}) //nolint:errcheck
+
+	result, err := client.GetToken(context.Background(), TokenRequest{})
+	if err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	if result.TokenType != "Bearer" {
+		t.Errorf("cached TokenType = %q; want Bearer", result.TokenType)
+	}
+}
+
+// --- Request coalescing ---
+
+// newGatedTokenServer counts token requests and holds each one until release
+// is closed.
+func newGatedTokenServer(t *testing.T, calls *int32, release chan struct{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"access_token": "coalesced",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetToken_CoalescesConcurrentCalls(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	srv := newGatedTokenServer(t, &calls, release)
+	client, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret"})
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := client.GetToken(context.Background(), TokenRequest{Scopes: []string{"read"}})
+			if err == nil && result.AccessToken != "coalesced" {
+				err = fmt.Errorf("AccessToken = %q", result.AccessToken)
+			}
+			errs <- err
+		}()
+	}
+
+	// Let every caller reach the in-flight request before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("GetToken() error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("token endpoint called %d times; want 1", calls)
+	}
+}
+
+func TestGetToken_CancelledCallerDoesNotCancelShared(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	srv := newGatedTokenServer(t, &calls, release)
+	client, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.GetToken(ctx, TokenRequest{})
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	secondResult := make(chan *TokenResult, 1)
+	go func() {
+		result, err := client.GetToken(context.Background(), TokenRequest{})
+		if err != nil {
+			t.Errorf("second GetToken() error: %v", err)
+		}
+		secondResult <- result
+	}()
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("first GetToken() error = %v; want context.Canceled", err)
+	}
+
+	close(release)
+	if result := <-secondResult; result == nil || result.AccessToken != "coalesced" {
+		t.Errorf("second GetToken() = %+v; want coalesced token", result)
+	}
+	if calls != 1 {
+		t.Errorf("token endpoint called %d times; want 1", calls)
+	}
+}
+
+// --- DefaultScopes ---
+
+func TestGetToken_DefaultScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		defaults  []string
+		requested []string
+		want      string
+	}{
+		{"default only", []string{"orders:read", "users:read"}, nil, "orders:read users:read"},
+		{"request only", nil, []string{"orders:write"}, "orders:write"},
+		{"merged", []string{"orders:read", "users:read"}, []string{"users:read", "orders:write"}, "orders:read users:read orders:write"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm() //nolint:errcheck
+				got = r.PostForm.Get("scope")
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "tok", "expires_in": 3600}) //nolint:errcheck
+			}))
+			defer srv.Close()
+
+			client, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret", DefaultScopes: tt.defaults})
+			if _, err := client.GetToken(context.Background(), TokenRequest{Scopes: tt.requested}); err != nil {
+				t.Fatalf("GetToken() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("scope = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetToken_DefaultScopesShareCacheKey(t *testing.T) {
+	var calls int32
+	srv := newCountingTokenServer(t, &calls)
+	client, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret", DefaultScopes: []string{"read"}})
+
+	ctx := context.Background()
+	client.GetToken(ctx, TokenRequest{})                          //nolint:errcheck
+	client.GetToken(ctx, TokenRequest{Scopes: []string{"read"}})  //nolint:errcheck
+	client.GetToken(ctx, TokenRequest{Scopes: []string{"write"}}) //nolint:errcheck
+
+	// The first two have the same effective scopes; the third adds write.
+	if calls != 2 {
+		t.Errorf("token endpoint called %d times; want 2", calls)
+	}
+}
+
+func TestGetToken_StringExpiresIn(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"tok","token_type":"Bearer","expires_in":"7200"}`)) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+	before := time.Now().Unix()
+	result, err := m.GetToken(context.Background(), TokenRequest{})
+	if err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	if result.ExpiresAt < before+7200 || result.ExpiresAt > time.Now().Unix()+7200 {
+		t.Errorf("ExpiresAt = %d; want about %d", result.ExpiresAt, before+7200)
+	}
+}
+
+func TestGetToken_SlowFetchDoesNotReplaceFresherToken(t *testing.T) {
+	slowStarted := make(chan struct{})
+	releaseSlow := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("X-Tenant-Slug") == "slow" {
+			close(slowStarted)
+			<-releaseSlow
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "older", "expires_in": 1800}) //nolint:errcheck
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "fresher", "expires_in": 3600}) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+
+	// Two clients share one cache. The tenant header only routes the test
+	// server; the cache key is forced equal so both fetches target one entry.
+	cache := NewMemoryTokenCache()
+	slow, _ := NewM2MClient(M2MConfig{Domain: srv.URL, TenantID: "slow", ClientID: "svc", ClientSecret: "secret", Cache: cache})
+	fast, _ := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret", Cache: cache})
+	key := fast.cacheKey(nil)
+
+	slowDone := make(chan *TokenResult)
+	go func() {
+		result, err := slow.requestToken(context.Background(), key, TokenRequest{})
+		if err != nil {
+			t.Errorf("slow requestToken() error: %v", err)
+		}
+		slowDone <- result
+	}()
+	<-slowStarted
+
+	if result, err := fast.GetToken(context.Background(), TokenRequest{}); err != nil || result.AccessToken != "fresher" {
+		t.Fatalf("fast GetToken() = %+v, %v; want fresher", result, err)
+	}
+	close(releaseSlow)
+	if result := <-slowDone; result == nil || result.AccessToken != "fresher" {
+		t.Errorf("slow requestToken() = %+v; want the cached fresher token", result)
+	}
+
+	cached, ok := cache.Get(key)
+	if !ok || cached.AccessToken != "fresher" {
+		t.Errorf("cached token = %+v; want fresher", cached)
+	}
+}
+
+func TestGetToken_ExtraHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "tok", "expires_in": 3600}) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := NewM2MClient(M2MConfig{
+		Domain:       srv.URL,
+		TenantID:     "acme",
+		ClientID:     "svc",
+		ClientSecret: "secret",
+		ExtraHeaders: map[string]string{
+			"X-Api-Key":     "k-123",
+			"Content-Type":  "application/json",
+			"X-Tenant-Slug": "other",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+	if _, err := m.GetToken(context.Background(), TokenRequest{}); err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+
+	want := map[string]string{
+		"X-Api-Key":     "k-123",
+		"Content-Type":  "application/x-www-form-urlencoded",
+		"X-Tenant-Slug": "acme",
+	}
+	for name, v := range want {
+		if got.Get(name) != v {
+			t.Errorf("%s = %q; want %q", name, got.Get(name), v)
+		}
+	}
+}
+
+func TestGetToken_RequestID(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "tok", "expires_in": 3600}) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := NewM2MClient(M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	if _, err := m.GetToken(ctx, TokenRequest{Scopes: []string{"a"}}); err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	if v := got.Get("X-Request-Id"); v != "req-42" {
+		t.Errorf("X-Request-Id = %q; want req-42", v)
+	}
+
+	// A different scope set misses the cache and makes a second request.
+	if _, err := m.GetToken(context.Background(), TokenRequest{Scopes: []string{"b"}}); err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	if v, ok := got["X-Request-Id"]; ok {
+		t.Errorf("X-Request-Id = %q; want none without an ID in the context", v)
+	}
+}
@@ -1,40 +1,198 @@
 package hellojohn
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// TokenVerifier verifies a bearer token and returns its claims.
+// *Client is the production implementation; tests can supply a fake.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string, opts ...VerifyOption) (*Claims, error)
+}
+
+var _ TokenVerifier = (*Client)(nil)
+
 // RequireAuth returns middleware that verifies the JWT Bearer token
 // and injects claims into the request context.
-// Returns 401 if no valid token is present.
+// Returns 401 if no valid token is present, or 503 with Retry-After if the
+// token could not be checked because the JWKS was unreachable and no cached
+// key applied.
+// If Config.ClaimsTransformer is set, it runs before the claims are injected
+// and a transformer error also yields 401.
 func (c *Client) RequireAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := extractBearerToken(r)
-		if token == "" {
-			writeJSON(w, http.StatusUnauthorized, `{"error":"Unauthorized","message":"missing bearer token"}`)
-			return
-		}
+	return requireAuth(c, c.authHooks())(next)
+}
+
+// RequireAuthWith is RequireAuth for an arbitrary TokenVerifier, so handlers
+// can be tested with a fake verifier instead of a real JWKS.
+func RequireAuthWith(v TokenVerifier) func(http.Handler) http.Handler {
+	return requireAuth(v, authHooks{})
+}
+
+// jwksRetryAfter is the Retry-After, in seconds, sent when keys cannot be
+// fetched: the backoff before a failing JWKS endpoint is tried again.
+var jwksRetryAfter = strconv.Itoa(int(failedRefreshBackoff / time.Second))
+
+// writeVerifyFailure writes the response for a token that failed
+// verification: 503 with Retry-After if the keys to check it could not be
+// fetched, since the token may well be valid, and 401 with message
+// otherwise.
+func writeVerifyFailure(w http.ResponseWriter, err error, message string, t ErrorBodyTemplate) {
+	if errors.Is(err, ErrJWKSFetchFailed) {
+		w.Header().Set("Retry-After", jwksRetryAfter)
+		writeErrorWith(w, http.StatusServiceUnavailable, "authentication keys unavailable", t)
+		return
+	}
+	writeErrorWith(w, http.StatusUnauthorized, message, t)
+}
+
+// authHooks are the Client settings requireAuth applies. RequireAuthWith has
+// no Client and uses none.
+type authHooks struct {
+	transform func(context.Context, *Claims) (*Claims, error)
+	onSuccess func(context.Context, *Claims)
+	errorBody ErrorBodyTemplate
+}
+
+func (c *Client) authHooks() authHooks {
+	return authHooks{
+		transform: c.config.ClaimsTransformer,
+		onSuccess: c.config.OnAuthSuccess,
+		errorBody: c.config.ErrorBodyTemplate,
+	}
+}
 
-		claims, err := c.VerifyToken(r.Context(), token)
-		if err != nil {
-			writeJSON(w, http.StatusUnauthorized, `{"error":"Unauthorized","message":"invalid token"}`)
+// serve finishes authenticating r with verified claims: it applies the
+// transformer, injects the result into the context, calls the success hook
+// and then next. A transformer error or nil result is answered with 401.
+func (h authHooks) serve(w http.ResponseWriter, r *http.Request, claims *Claims, next http.Handler) {
+	if h.transform != nil {
+		var err error
+		claims, err = h.transform(r.Context(), claims)
+		if err != nil || claims == nil {
+			writeErrorWith(w, http.StatusUnauthorized, "invalid token", h.errorBody)
 			return
 		}
+	}
+
+	ctx := contextWithClaims(r.Context(), claims)
+	if h.onSuccess != nil {
+		h.onSuccess(ctx, claims)
+	}
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func requireAuth(v TokenVerifier, hooks authHooks) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := extractBearerToken(r)
+			if token == "" {
+				writeErrorWith(w, http.StatusUnauthorized, "missing bearer token", hooks.errorBody)
+				return
+			}
 
-		ctx := contextWithClaims(r.Context(), claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			claims, err := v.VerifyToken(r.Context(), token)
+			if err != nil {
+				writeVerifyFailure(w, err, "invalid token", hooks.errorBody)
+				return
+			}
+			hooks.serve(w, r, claims, next)
+		})
+	}
+}
+
+// DefaultAPIKeyHeader is the header RequireAuthOrAPIKey reads API keys from.
+const DefaultAPIKeyHeader = "X-Api-Key"
+
+// RequireAuthOrAPIKey returns middleware that authenticates with a bearer
+// token exactly as RequireAuth does when one is present, and otherwise with
+// the X-Api-Key header, which validate turns into claims. Returns 401 if
+// neither is present, or if the credential that is present fails; a bad
+// bearer token does not fall back to the API key. Claims from validate are
+// injected as returned, without Config.ClaimsTransformer or
+// Config.OnAuthSuccess.
+func (c *Client) RequireAuthOrAPIKey(validate func(ctx context.Context, key string) (*Claims, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		bearer := c.RequireAuth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if extractBearerToken(r) != "" {
+				bearer.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get(DefaultAPIKeyHeader)
+			if key == "" {
+				c.writeError(w, http.StatusUnauthorized, "missing bearer token or API key")
+				return
+			}
+			claims, err := validate(r.Context(), key)
+			if err != nil || claims == nil {
+				c.writeError(w, http.StatusUnauthorized, "invalid API key")
+				return
+			}
+			ctx := contextWithClaims(r.Context(), claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// VerifyRequest extracts the bearer token from r and verifies it, for handlers
+// that are not wrapped in RequireAuth. Returns ErrUnauthorized if r carries no
+// bearer token.
+func (c *Client) VerifyRequest(r *http.Request, opts ...VerifyOption) (*Claims, error) {
+	token := extractBearerToken(r)
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing bearer token", ErrUnauthorized)
+	}
+	return c.VerifyToken(r.Context(), token, opts...)
 }
 
 // RequireScope returns middleware that checks for a specific scope in the JWT claims.
-// Must be used after RequireAuth. Returns 403 if the scope is missing.
+// Must be used after RequireAuth. Returns Config.InsufficientScopeStatus (default 403)
+// if the scope is missing.
 func (c *Client) RequireScope(scope string) func(http.Handler) http.Handler {
+	return c.require(Requirement{Kind: RequirementScope, Value: scope})
+}
+
+// RequireRole returns middleware that checks for a specific role in the JWT claims.
+// Must be used after RequireAuth. Returns Config.InsufficientScopeStatus (default 403)
+// if the role is missing.
+func (c *Client) RequireRole(role string) func(http.Handler) http.Handler {
+	return c.require(Requirement{Kind: RequirementRole, Value: role})
+}
+
+// RequirePermission returns middleware that checks for a specific permission in the JWT claims.
+// Must be used after RequireAuth. Returns Config.InsufficientScopeStatus (default 403)
+// if the permission is missing.
+func (c *Client) RequirePermission(perm string) func(http.Handler) http.Handler {
+	return c.require(Requirement{Kind: RequirementPermission, Value: perm})
+}
+
+// RequireResourceScope returns middleware that requires a scope derived from
+// the request method: resource+":read" for GET, HEAD and OPTIONS,
+// resource+":delete" for DELETE, and resource+":write" for every other
+// method. Must be used after RequireAuth. Returns
+// Config.InsufficientScopeStatus (default 403) naming the missing scope.
+func (c *Client) RequireResourceScope(resource string) func(http.Handler) http.Handler {
+	return c.RequireResourceScopeFrom(func(*http.Request) string { return resource })
+}
+
+// RequireResourceScopeFrom is RequireResourceScope with the resource read
+// from each request by extract, e.g. PathValueExtractor("resource") for a
+// route registered as "/api/{resource}/{id}".
+func (c *Client) RequireResourceScopeFrom(extract func(*http.Request) string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := Scope(extract(r) + ":" + methodAction(r.Method))
 			claims := ClaimsFromContext(r.Context())
-			if claims == nil || !claims.HasScope(scope) {
-				writeJSON(w, http.StatusForbidden, `{"error":"Forbidden","message":"insufficient scope"}`)
+			if claims == nil || !c.authorize(claims, req) {
+				c.writeForbidden(w, r, claims, req, req.Value)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -42,14 +200,17 @@ func (c *Client) RequireScope(scope string) func(http.Handler) http.Handler {
 	}
 }
 
-// RequireRole returns middleware that checks for a specific role in the JWT claims.
-// Must be used after RequireAuth. Returns 403 if the role is missing.
-func (c *Client) RequireRole(role string) func(http.Handler) http.Handler {
+// DenyScope returns middleware that rejects tokens carrying any of scopes,
+// the inverse of RequireScope, e.g. DenyScope("write") on routes that must
+// stay read-only during a maintenance window. Must be used after
+// RequireAuth. Returns 403 if a listed scope is present or there are no
+// claims.
+func (c *Client) DenyScope(scopes ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims := ClaimsFromContext(r.Context())
-			if claims == nil || !claims.HasRole(role) {
-				writeJSON(w, http.StatusForbidden, `{"error":"Forbidden","message":"insufficient role"}`)
+			if claims == nil || claims.HasAnyScope(scopes...) {
+				c.writeError(w, http.StatusForbidden, "forbidden scope")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -57,14 +218,56 @@ func (c *Client) RequireRole(role string) func(http.Handler) http.Handler {
 	}
 }
 
-// RequirePermission returns middleware that checks for a specific permission in the JWT claims.
-// Must be used after RequireAuth. Returns 403 if the permission is missing.
-func (c *Client) RequirePermission(perm string) func(http.Handler) http.Handler {
+// methodAction maps an HTTP method to the action suffix RequireResourceScope
+// checks.
+func methodAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "read"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return "write"
+}
+
+// DefaultTenantHeader is the header RequireTenantHeaderMatch reads when no name is given.
+const DefaultTenantHeader = "X-Tenant-Slug"
+
+// RequireTenantHeaderMatch returns middleware that checks the named request header
+// (default X-Tenant-Slug) against the token's tenant ID. Must be used after
+// RequireAuth. Returns 403 if the header is missing or does not match.
+func (c *Client) RequireTenantHeaderMatch(headerName string) func(http.Handler) http.Handler {
+	if headerName == "" {
+		headerName = DefaultTenantHeader
+	}
+	extract := func(r *http.Request) string { return r.Header.Get(headerName) }
+	return c.requireTenant(extract, "missing tenant header")
+}
+
+// RequireTenant returns middleware that checks the tenant read from each
+// request by extract against the token's tenant ID, e.g.
+// PathValueExtractor("tenant") for a route registered as
+// "GET /t/{tenant}/orders". Must be used after RequireAuth. Returns 403 if
+// extract returns "" or a different tenant.
+func (c *Client) RequireTenant(extract func(*http.Request) string) func(http.Handler) http.Handler {
+	return c.requireTenant(extract, "missing tenant")
+}
+
+func (c *Client) requireTenant(extract func(*http.Request) string, missing string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims := ClaimsFromContext(r.Context())
-			if claims == nil || !claims.HasPermission(perm) {
-				writeJSON(w, http.StatusForbidden, `{"error":"Forbidden","message":"insufficient permission"}`)
+			if claims == nil {
+				c.writeError(w, http.StatusForbidden, "tenant mismatch")
+				return
+			}
+			tenant := extract(r)
+			if tenant == "" {
+				c.writeError(w, http.StatusForbidden, missing)
+				return
+			}
+			if tenant != claims.TenantID {
+				c.writeError(w, http.StatusForbidden, "tenant mismatch")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -72,16 +275,220 @@ func (c *Client) RequirePermission(perm string) func(http.Handler) http.Handler
 	}
 }
 
+// RequireAudience returns middleware that checks the verified token's aud claim
+// against a route-specific audience, for services that serve several APIs from
+// one Client configured without Config.Audience. Must be used after
+// RequireAuth. Returns 403 if the token's aud claim does not include aud.
+func (c *Client) RequireAudience(aud string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil || !matchesAudience(claims.Raw["aud"], aud) {
+				c.writeError(w, http.StatusForbidden, "audience mismatch")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireFreshAuth returns middleware that requires the user to have
+// authenticated within maxAge, for sensitive operations that warrant a
+// recent login. The authentication time is the auth_time claim, or iat when
+// the token has none. Must be used after RequireAuth. Returns 403 with a
+// WWW-Authenticate insufficient_user_authentication challenge (RFC 9470)
+// carrying max_age if the authentication is older or its time is unknown.
+func (c *Client) RequireFreshAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	challenge := fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int64(maxAge/time.Second))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil || !c.authenticatedWithin(claims, maxAge) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				c.writeError(w, http.StatusForbidden, "authentication too old")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireACR returns middleware that requires the token's acr claim to be
+// one of levels, for operations that need a given authentication assurance
+// level. Must be used after RequireAuth. Returns 403 with a WWW-Authenticate
+// insufficient_user_authentication challenge (RFC 9470) listing levels in
+// acr_values if the acr is missing or not allowed.
+func (c *Client) RequireACR(levels ...string) func(http.Handler) http.Handler {
+	challenge := fmt.Sprintf(`Bearer error="insufficient_user_authentication", acr_values=%q`, strings.Join(levels, " "))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil || claims.AuthContextClass == "" || !containsString(levels, claims.AuthContextClass) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				c.writeError(w, http.StatusForbidden, "insufficient authentication context")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticatedWithin reports whether the claims' AuthTime, or IssuedAt in
+// its absence, lies within maxAge of now.
+func (c *Client) authenticatedWithin(claims *Claims, maxAge time.Duration) bool {
+	authTime := claims.AuthTime
+	if authTime == 0 {
+		authTime = claims.IssuedAt
+	}
+	if authTime == 0 {
+		return false
+	}
+	return c.verifier.now().Sub(time.Unix(authTime, 0)) <= maxAge
+}
+
+// RequireTokenType returns middleware that accepts only tokens whose typ
+// header is one of types, e.g. RequireTokenType("at+jwt") to refuse ID
+// tokens signed with the same keys. Comparison ignores case and an
+// "application/" prefix, per RFC 7515. Must be used after RequireAuth.
+// Returns 401 if the type does not match, since the token is not a valid
+// credential for the route.
+func (c *Client) RequireTokenType(types ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[normalizeTyp(t)] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil || !allowed[normalizeTyp(claims.Header.Typ)] {
+				c.writeError(w, http.StatusUnauthorized, "invalid token type")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// normalizeTyp lowercases a typ value and drops an "application/" prefix, so
+// "at+jwt" and "application/AT+JWT" compare equal.
+func normalizeTyp(typ string) string {
+	typ = strings.ToLower(typ)
+	return strings.TrimPrefix(typ, "application/")
+}
+
+// require returns middleware that delegates the check to the configured Authorizer.
+func (c *Client) require(req Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil || !c.authorize(claims, req) {
+				c.writeForbidden(w, r, claims, req, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeForbidden writes the failure response for an unmet requirement using
+// Config.InsufficientScopeStatus, after reporting it to Config.OnDenial.
+// required, when non-empty, is reported in the envelope's "required" field.
+func (c *Client) writeForbidden(w http.ResponseWriter, r *http.Request, claims *Claims, req Requirement, required string) {
+	if c.config.OnDenial != nil {
+		c.config.OnDenial(r.Context(), newDenial(claims, req))
+	}
+	status := c.config.InsufficientScopeStatus
+	if status == http.StatusForbidden {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+	}
+	writeJSON(w, status, c.config.ErrorBodyTemplate.body(errorResponse{
+		Error:    http.StatusText(status),
+		Message:  "insufficient " + req.Kind.String(),
+		Required: required,
+	}))
+}
+
+// extractBearerToken returns the first non-empty bearer token found across all
+// Authorization header values. Proxies sometimes add their own Authorization
+// header ahead of the client's, so the first value is not necessarily ours.
+// Whitespace around the header value and the token, including extra spaces
+// after "Bearer", is ignored.
 func extractBearerToken(r *http.Request) string {
-	header := r.Header.Get("Authorization")
-	if !strings.HasPrefix(header, "Bearer ") {
-		return ""
+	for _, header := range r.Header.Values("Authorization") {
+		header = strings.TrimSpace(header)
+		if !strings.HasPrefix(header, "Bearer ") {
+			continue
+		}
+		if token := strings.TrimSpace(header[len("Bearer "):]); token != "" {
+			return token
+		}
 	}
-	return header[7:]
+	return ""
 }
 
-func writeJSON(w http.ResponseWriter, status int, body string) {
+// errorResponse is the JSON envelope written by the middleware on failure.
+type errorResponse struct {
+	Error    string `json:"error"`
+	Message  string `json:"message"`
+	Required string `json:"required,omitempty"`
+}
+
+// ErrorBodyTemplate renames the fields of the JSON error body the middleware
+// writes, e.g. ErrorField "code" and MessageField "detail" produce
+// {"code":"Forbidden","detail":"tenant mismatch"}. An empty field keeps its
+// default name; the "required" field is not renamed.
+type ErrorBodyTemplate struct {
+	// ErrorField replaces "error", which holds the HTTP status text.
+	ErrorField string
+
+	// MessageField replaces "message", which holds the failure reason.
+	MessageField string
+}
+
+// body returns e as it should be encoded under t.
+func (t ErrorBodyTemplate) body(e errorResponse) interface{} {
+	if t == (ErrorBodyTemplate{}) {
+		return e
+	}
+	errField, msgField := t.ErrorField, t.MessageField
+	if errField == "" {
+		errField = "error"
+	}
+	if msgField == "" {
+		msgField = "message"
+	}
+	m := map[string]string{errField: e.Error, msgField: e.Message}
+	if e.Required != "" {
+		m["required"] = e.Required
+	}
+	return m
+}
+
+// writeError writes the standard error envelope, using the status text
+// (e.g. "Unauthorized", "Forbidden") as the error field.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorWith(w, status, message, ErrorBodyTemplate{})
+}
+
+// writeError is writeError with c's Config.ErrorBodyTemplate.
+func (c *Client) writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorWith(w, status, message, c.config.ErrorBodyTemplate)
+}
+
+func writeErrorWith(w http.ResponseWriter, status int, message string, t ErrorBodyTemplate) {
+	writeJSON(w, status, t.body(errorResponse{Error: http.StatusText(status), Message: message}))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	if headerWritten(w) {
+		return
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body = []byte(`{"error":"Internal Server Error","message":"failed to encode response"}`)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	w.Write([]byte(body)) //nolint:errcheck
+	w.Write(body) //nolint:errcheck
 }
@@ -0,0 +1,28 @@
+package hellojohn
+
+// VerifyOption adjusts the checks performed by a single VerifyToken call.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	skipExpiry bool
+}
+
+func newVerifyOptions(opts []VerifyOption) verifyOptions {
+	var o verifyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithoutExpiryCheck skips the exp check while still verifying the signature
+// and every other claim. Claims.ExpiresAt is still populated.
+//
+// DANGER: an expired token proves who the subject was, not that the caller
+// is still authorized. Use this only to read identity from an access token
+// in flows such as refresh or logout, and never to grant access.
+func WithoutExpiryCheck() VerifyOption {
+	return func(o *verifyOptions) {
+		o.skipExpiry = true
+	}
+}
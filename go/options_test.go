@@ -0,0 +1,93 @@
+package hellojohn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithoutExpiryCheck_ExpiredTokenReturnsClaims(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	exp := time.Now().Add(-time.Hour).Unix()
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("VerifyToken() error = %v; want ErrTokenExpired", err)
+	}
+
+	claims, err := c.VerifyToken(context.Background(), token, WithoutExpiryCheck())
+	if err != nil {
+		t.Fatalf("VerifyToken(WithoutExpiryCheck) error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want %q", claims.UserID, "user-1")
+	}
+	if claims.ExpiresAt != exp {
+		t.Errorf("ExpiresAt = %d; want %d", claims.ExpiresAt, exp)
+	}
+}
+
+func TestWithoutExpiryCheck_StillVerifiesSignature(t *testing.T) {
+	srv, _ := newTestJWKSServer(t)
+	_, otherPriv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, otherPriv, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	_, err = c.VerifyToken(context.Background(), token, WithoutExpiryCheck())
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken(WithoutExpiryCheck) error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestWithoutExpiryCheck_StillChecksAudience(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, Audience: "api"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"aud": "other",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	_, err = c.VerifyToken(context.Background(), token, WithoutExpiryCheck())
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken(WithoutExpiryCheck) error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyForLogout(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	_, otherPriv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	payload := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()}
+
+	claims, err := c.VerifyForLogout(context.Background(), signTestToken(t, priv, payload))
+	if err != nil {
+		t.Fatalf("expired token: VerifyForLogout() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want user-1", claims.UserID)
+	}
+
+	_, err = c.VerifyForLogout(context.Background(), signTestToken(t, otherPriv, payload))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("bad signature: VerifyForLogout() error = %v; want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build go1.22
+
+package hellojohn
+
+import "net/http"
+
+// PathValueExtractor returns an extractor for RequireTenant or
+// RequireResourceScopeFrom that reads the named wildcard of the route the
+// request matched on a Go 1.22+ http.ServeMux:
+//
+//	mux.Handle("GET /t/{tenant}/orders", client.RequireAuth(
+//		client.RequireTenant(hellojohn.PathValueExtractor("tenant"))(orders)))
+func PathValueExtractor(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.PathValue(name)
+	}
+}
@@ -0,0 +1,65 @@
+//go:build go1.22
+
+// The module declares go 1.21, which keeps ServeMux on the pre-1.22 pattern
+// syntax by default.
+//go:debug httpmuxgo121=0
+
+package hellojohn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathValueExtractor_RequireTenant(t *testing.T) {
+	c := newTestClient(t)
+	mux := http.NewServeMux()
+	mux.Handle("GET /t/{tenant}/orders/{id}", claimsInjector(&Claims{TenantID: "acme"})(
+		c.RequireTenant(PathValueExtractor("tenant"))(okHandler)))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/t/acme/orders/1", http.StatusOK},
+		{"/t/other/orders/1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status = %d; want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestPathValueExtractor_RequireResourceScopeFrom(t *testing.T) {
+	c := newTestClient(t)
+	mux := http.NewServeMux()
+	mux.Handle("/api/{resource}/{id}", claimsInjector(&Claims{Scopes: []string{"orders:read"}})(
+		c.RequireResourceScopeFrom(PathValueExtractor("resource"))(okHandler)))
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/orders/1", http.StatusOK},
+		{http.MethodDelete, "/api/orders/1", http.StatusForbidden},
+		{http.MethodGet, "/api/invoices/1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d; want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestPathValueExtractor_NoMatch(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/t/acme", nil)
+	if got := PathValueExtractor("tenant")(r); got != "" {
+		t.Errorf("PathValueExtractor() = %q; want empty", got)
+	}
+}
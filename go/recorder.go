@@ -0,0 +1,73 @@
+package hellojohn
+
+import "net/http"
+
+// StatusRecorder wraps an http.ResponseWriter and records the status code
+// written through it, so logging middleware placed around RequireAuth and
+// the Require* middleware can see the status the auth layer responded with:
+//
+//	func logging(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			rec := hellojohn.NewStatusRecorder(w)
+//			next.ServeHTTP(rec, r)
+//			log.Printf("%s %s -> %d", r.Method, r.URL.Path, rec.Status())
+//		})
+//	}
+//	handler := logging(client.RequireAuth(api))
+//
+// The SDK's middleware also consults a StatusRecorder anywhere in the
+// writer chain before writing an error: if a response was already started
+// upstream, it writes nothing rather than a second status and body.
+type StatusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// NewStatusRecorder returns a StatusRecorder writing to w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+// Status returns the status code written so far: the first WriteHeader
+// argument, 200 if the body was written without WriteHeader, or 0 if nothing
+// has been written.
+func (s *StatusRecorder) Status() int {
+	return s.status
+}
+
+// WriteHeader records status and passes it on.
+func (s *StatusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Write passes b on, recording an implicit 200 if no status was written.
+func (s *StatusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// headerWritten reports whether a StatusRecorder in w's Unwrap chain has
+// seen a response started.
+func headerWritten(w http.ResponseWriter) bool {
+	for w != nil {
+		if rec, ok := w.(*StatusRecorder); ok && rec.status != 0 {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package hellojohn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatusRecorder_AroundRequireAuth(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	var recorded int
+	logging := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := NewStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+			recorded = rec.Status()
+		})
+	}
+	handler := logging(c.RequireAuth(c.RequireScope("admin")(okHandler)))
+
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"scp": []string{"read"},
+	})
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing token", ""},
+		{"invalid token", "Bearer not-a-token"},
+		{"insufficient scope", "Bearer " + token},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if recorded != rec.Code {
+			t.Errorf("%s: recorded status %d; response status %d", tt.name, recorded, rec.Code)
+		}
+	}
+}
+
+func TestStatusRecorder_ImplicitOK(t *testing.T) {
+	rec := NewStatusRecorder(httptest.NewRecorder())
+	if rec.Status() != 0 {
+		t.Errorf("Status() before writing = %d; want 0", rec.Status())
+	}
+	rec.Write([]byte("ok"))
+	rec.WriteHeader(http.StatusTeapot)
+	if rec.Status() != http.StatusOK {
+		t.Errorf("Status() = %d; want %d", rec.Status(), http.StatusOK)
+	}
+}
+
+// countingWriter counts WriteHeader calls, which net/http would log as
+// superfluous after the first.
+type countingWriter struct {
+	*httptest.ResponseRecorder
+	writeHeaders int
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	w.writeHeaders++
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func TestWriteError_SkippedAfterUpstreamWrite(t *testing.T) {
+	c := newTestClient(t)
+	outer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := NewStatusRecorder(w)
+			rec.WriteHeader(http.StatusServiceUnavailable)
+			next.ServeHTTP(rec, r)
+		})
+	}
+	handler := outer(c.RequireAuth(okHandler))
+
+	w := &countingWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.writeHeaders != 1 {
+		t.Errorf("WriteHeader called %d times; want 1", w.writeHeaders)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body = %q; want empty", w.Body.String())
+	}
+}
+
+func TestWriteError_WrittenThroughFreshRecorder(t *testing.T) {
+	c := newTestClient(t)
+	rec := NewStatusRecorder(httptest.NewRecorder())
+	c.RequireAuth(okHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Status() != http.StatusUnauthorized {
+		t.Errorf("Status() = %d; want %d", rec.Status(), http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,168 @@
+// Package redishj provides a Redis-backed hellojohn.TokenCache, so that M2M
+// tokens are shared across replicas instead of each replica requesting its
+// own from the token endpoint.
+//
+// It lives in its own module to keep the core SDK free of dependencies.
+//
+//	cache, err := redishj.New(redishj.Config{Client: rdb})
+//	m2m, err := hellojohn.NewM2MClient(hellojohn.M2MConfig{
+//		// ...
+//		Cache: cache,
+//	})
+package redishj
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	hellojohn "github.com/dropDatabas3/hellojohn-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix namespaces the keys written by Cache. Keys read
+// "<prefix><clientID>:<scopes>:<tenantID>:<domain>", with "%" and ":" in
+// each part percent-encoded, e.g. "hj:m2m:svc:read write::https%3A//auth.example.com".
+const DefaultPrefix = "hj:m2m:"
+
+// DefaultTimeout bounds each Redis operation.
+const DefaultTimeout = time.Second
+
+// Config configures a Cache.
+type Config struct {
+	// Client is the Redis client. Required.
+	Client redis.UniversalClient
+
+	// Prefix is prepended to every key. Default: DefaultPrefix.
+	Prefix string
+
+	// Timeout bounds each Redis operation. Default: DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Cache is a hellojohn.TokenCache stored in Redis. Entries expire in Redis
+// when the token does. Redis errors are treated as cache misses, so an
+// unavailable Redis degrades to requesting tokens from the server.
+type Cache struct {
+	client  redis.UniversalClient
+	prefix  string
+	timeout time.Duration
+	now     func() time.Time
+}
+
+var _ hellojohn.TokenCache = (*Cache)(nil)
+
+// entry is the JSON value stored under each key.
+type entry struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// New creates a Redis-backed token cache.
+func New(cfg Config) (*Cache, error) {
+	if cfg.Client == nil {
+		return nil, fmt.Errorf("redishj: client is required")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Cache{
+		client:  cfg.Client,
+		prefix:  cfg.Prefix,
+		timeout: cfg.Timeout,
+		now:     time.Now,
+	}, nil
+}
+
+// keyPartEscaper escapes the separator in each part of a Redis key, so
+// distinct M2M keys never map to the same Redis key.
+var keyPartEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// redisKey turns an M2MClient cache key, which separates the domain, tenant,
+// client ID and scopes with newlines, into a readable Redis key led by the
+// client ID and scopes. Each part is escaped, so a ":" inside one cannot be
+// mistaken for a separator. Keys of any other shape are escaped whole.
+func (c *Cache) redisKey(key string) string {
+	parts := strings.Split(key, "\n")
+	if len(parts) != 4 {
+		return c.prefix + keyPartEscaper.Replace(key)
+	}
+	domain, tenantID, clientID, scopes := parts[0], parts[1], parts[2], parts[3]
+	for _, p := range []*string{&domain, &tenantID, &clientID, &scopes} {
+		*p = keyPartEscaper.Replace(*p)
+	}
+	return c.prefix + clientID + ":" + scopes + ":" + tenantID + ":" + domain
+}
+
+// Get returns the token stored under key. Keys come from the M2MClient and
+// already identify the domain, tenant, client ID and scopes.
+func (c *Cache) Get(key string) (*hellojohn.CachedToken, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	data, err := c.client.Get(ctx, c.redisKey(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false
+	}
+	return &hellojohn.CachedToken{AccessToken: e.AccessToken, TokenType: e.TokenType, ExpiresAt: e.ExpiresAt}, true
+}
+
+// Set stores token under key until the token expires. Already-expired tokens
+// are not stored.
+func (c *Cache) Set(key string, token *hellojohn.CachedToken) {
+	ttl := time.Unix(token.ExpiresAt, 0).Sub(c.now())
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(entry{AccessToken: token.AccessToken, TokenType: token.TokenType, ExpiresAt: token.ExpiresAt})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	c.client.Set(ctx, c.redisKey(key), data, ttl) //nolint:errcheck
+}
+
+// Delete removes the token stored under key.
+func (c *Cache) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	c.client.Del(ctx, c.redisKey(key)) //nolint:errcheck
+}
+
+// Clear removes every key under the cache's prefix. Other keys in the Redis
+// database are left alone.
+func (c *Cache) Clear() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// SCAN only covers one node, so a cluster is cleared master by master.
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error { //nolint:errcheck
+			return c.clearNode(ctx, node)
+		})
+		return
+	}
+	c.clearNode(ctx, c.client) //nolint:errcheck
+}
+
+func (c *Cache) clearNode(ctx context.Context, client redis.Cmdable) error {
+	iter := client.Scan(ctx, 0, c.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
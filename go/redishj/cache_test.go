@@ -0,0 +1,198 @@
+package redishj
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	hellojohn "github.com/dropDatabas3/hellojohn-go"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cache, err := New(Config{Client: rdb})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return cache, mr
+}
+
+func TestNew_RequiresClient(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("New() error = nil; want error for missing client")
+	}
+}
+
+func TestCache_SetGet(t *testing.T) {
+	cache, mr := newTestCache(t)
+	expiresAt := time.Now().Add(time.Hour).Unix()
+
+	cache.Set("svc.read", &hellojohn.CachedToken{AccessToken: "tok", ExpiresAt: expiresAt})
+
+	got, ok := cache.Get("svc.read")
+	if !ok {
+		t.Fatal("Get() ok = false; want true")
+	}
+	if got.AccessToken != "tok" || got.ExpiresAt != expiresAt {
+		t.Errorf("Get() = %+v; want tok/%d", got, expiresAt)
+	}
+	if !mr.Exists(DefaultPrefix + "svc.read") {
+		t.Errorf("key %q not found in Redis; keys = %v", DefaultPrefix+"svc.read", mr.Keys())
+	}
+}
+
+func TestCache_GetMissing(t *testing.T) {
+	cache, _ := newTestCache(t)
+	if _, ok := cache.Get("missing"); ok {
+		t.Error("Get() ok = true; want false")
+	}
+}
+
+func TestCache_TTLMatchesExpiry(t *testing.T) {
+	cache, mr := newTestCache(t)
+	cache.Set("k", &hellojohn.CachedToken{AccessToken: "tok", ExpiresAt: time.Now().Add(10 * time.Minute).Unix()})
+
+	ttl := mr.TTL(DefaultPrefix + "k")
+	if ttl <= 9*time.Minute || ttl > 10*time.Minute {
+		t.Errorf("TTL = %v; want about 10m", ttl)
+	}
+
+	mr.FastForward(11 * time.Minute)
+	if _, ok := cache.Get("k"); ok {
+		t.Error("Get() ok = true after expiry; want false")
+	}
+}
+
+func TestCache_ExpiredTokenNotStored(t *testing.T) {
+	cache, mr := newTestCache(t)
+	cache.Set("k", &hellojohn.CachedToken{AccessToken: "tok", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if mr.Exists(DefaultPrefix + "k") {
+		t.Error("expired token was stored")
+	}
+}
+
+func TestCache_Delete(t *testing.T) {
+	cache, _ := newTestCache(t)
+	cache.Set("k", &hellojohn.CachedToken{AccessToken: "tok", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	cache.Delete("k")
+	if _, ok := cache.Get("k"); ok {
+		t.Error("Get() ok = true after Delete; want false")
+	}
+}
+
+func TestCache_ClearOnlyPrefixedKeys(t *testing.T) {
+	cache, mr := newTestCache(t)
+	mr.Set("other:key", "keep") //nolint:errcheck
+	for _, k := range []string{"a", "b", "c"} {
+		cache.Set(k, &hellojohn.CachedToken{AccessToken: k, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	}
+
+	cache.Clear()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if _, ok := cache.Get(k); ok {
+			t.Errorf("Get(%q) ok = true after Clear; want false", k)
+		}
+	}
+	if !mr.Exists("other:key") {
+		t.Error("Clear() removed a key outside the prefix")
+	}
+}
+
+func TestCache_RedisDownIsMiss(t *testing.T) {
+	cache, mr := newTestCache(t)
+	cache.Set("k", &hellojohn.CachedToken{AccessToken: "tok", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	mr.Close()
+	if _, ok := cache.Get("k"); ok {
+		t.Error("Get() ok = true with Redis down; want false")
+	}
+}
+
+func TestCache_SharedAcrossM2MClients(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"access_token": "shared-token",
+			"expires_in":   3600,
+		})
+	}))
+	defer srv.Close()
+
+	cache, _ := newTestCache(t)
+	cfg := hellojohn.M2MConfig{Domain: srv.URL, ClientID: "svc", ClientSecret: "secret", Cache: cache}
+
+	// Two clients stand in for two replicas sharing one Redis.
+	for i := 0; i < 2; i++ {
+		m2m, err := hellojohn.NewM2MClient(cfg)
+		if err != nil {
+			t.Fatalf("NewM2MClient() error: %v", err)
+		}
+		tok, err := m2m.GetToken(context.Background(), hellojohn.TokenRequest{Scopes: []string{"read"}})
+		if err != nil {
+			t.Fatalf("GetToken() error: %v", err)
+		}
+		if tok.AccessToken != "shared-token" {
+			t.Errorf("AccessToken = %q; want shared-token", tok.AccessToken)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("token endpoint called %d times; want 1", calls)
+	}
+}
+
+func TestCache_M2MKeysAreReadable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"access_token": "tok",
+			"expires_in":   3600,
+		})
+	}))
+	defer srv.Close()
+
+	cache, mr := newTestCache(t)
+	m2m, err := hellojohn.NewM2MClient(hellojohn.M2MConfig{
+		Domain: srv.URL, TenantID: "acme", ClientID: "svc", ClientSecret: "secret", Cache: cache,
+	})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+	if _, err := m2m.GetToken(context.Background(), hellojohn.TokenRequest{Scopes: []string{"write", "read"}}); err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+
+	want := DefaultPrefix + "svc:read write:acme:" + strings.ReplaceAll(srv.URL, ":", "%3A")
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != want {
+		t.Errorf("keys = %q; want [%q]", keys, want)
+	}
+}
+
+func TestCache_KeysDoNotCollide(t *testing.T) {
+	cache, mr := newTestCache(t)
+	expiresAt := time.Now().Add(time.Hour).Unix()
+
+	// Client "x:y" without scopes and client "x" with scope "y".
+	cache.Set("https://auth.example.com\n\nx:y\n", &hellojohn.CachedToken{AccessToken: "tok-xy", ExpiresAt: expiresAt})
+	cache.Set("https://auth.example.com\n\nx\ny", &hellojohn.CachedToken{AccessToken: "tok-x", ExpiresAt: expiresAt})
+
+	if n := len(mr.Keys()); n != 2 {
+		t.Fatalf("keys = %q; want 2 distinct keys", mr.Keys())
+	}
+	if got, ok := cache.Get("https://auth.example.com\n\nx:y\n"); !ok || got.AccessToken != "tok-xy" {
+		t.Errorf("Get(x:y) = %+v, %v; want tok-xy", got, ok)
+	}
+}
@@ -0,0 +1,19 @@
+package hellojohn
+
+// KeycloakRolesExtractor returns a Config.RolesExtractor for Keycloak tokens.
+// It returns the realm roles from realm_access.roles followed by the roles of
+// clientID from resource_access.<clientID>.roles, without duplicates. With an
+// empty clientID only realm roles are returned.
+func KeycloakRolesExtractor(clientID string) func(payload map[string]interface{}) []string {
+	return func(payload map[string]interface{}) []string {
+		roles := extractStringSlice(lookupClaim(payload, "realm_access.roles"))
+		if clientID == "" {
+			return roles
+		}
+		// Client IDs may contain dots, so resource_access is walked by key
+		// rather than through a dotted path.
+		resources, _ := payload["resource_access"].(map[string]interface{})
+		client, _ := resources[clientID].(map[string]interface{})
+		return unionStrings(roles, extractStringSlice(client["roles"]))
+	}
+}
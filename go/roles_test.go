@@ -0,0 +1,68 @@
+package hellojohn
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// keycloakPayload is shaped like a Keycloak access token.
+func keycloakPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"offline_access", "user"},
+		},
+		"resource_access": map[string]interface{}{
+			"orders-api":  map[string]interface{}{"roles": []interface{}{"orders-admin", "user"}},
+			"billing.api": map[string]interface{}{"roles": []interface{}{"billing-viewer"}},
+		},
+	}
+}
+
+func TestKeycloakRolesExtractor(t *testing.T) {
+	tests := []struct {
+		clientID string
+		want     []string
+	}{
+		{"orders-api", []string{"offline_access", "user", "orders-admin"}},
+		{"billing.api", []string{"offline_access", "user", "billing-viewer"}},
+		{"unknown", []string{"offline_access", "user"}},
+		{"", []string{"offline_access", "user"}},
+	}
+	for _, tt := range tests {
+		got := KeycloakRolesExtractor(tt.clientID)(keycloakPayload())
+		if len(got) != len(tt.want) {
+			t.Errorf("client %q: roles = %v; want %v", tt.clientID, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("client %q: roles = %v; want %v", tt.clientID, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestKeycloakRolesExtractor_NoRoleClaims(t *testing.T) {
+	if got := KeycloakRolesExtractor("orders-api")(map[string]interface{}{"sub": "user-1"}); len(got) != 0 {
+		t.Errorf("roles = %v; want none", got)
+	}
+}
+
+func TestVerify_RolesExtractor(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, RolesExtractor: KeycloakRolesExtractor("orders-api")})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	claims, err := c.VerifyToken(context.Background(), signTestToken(t, priv, keycloakPayload()))
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if !claims.HasAllRoles("user", "orders-admin") || claims.HasRole("billing-viewer") {
+		t.Errorf("Roles = %v; want realm roles and orders-api roles", claims.Roles)
+	}
+}
@@ -0,0 +1,70 @@
+package hellojohn
+
+import "context"
+
+// VerifierSnapshot verifies tokens against a fixed set of keys captured by
+// Client.Snapshot, without any network access. It is safe for concurrent use.
+type VerifierSnapshot struct {
+	verifier *JWTVerifier
+}
+
+// Snapshot captures the keys c currently verifies against, fetching them
+// first if they are not cached or past Config.JWKSCacheTTL, and returns a
+// verifier that never fetches again. It is meant for batch jobs that must
+// not make network calls mid-run:
+//
+//	snap, err := client.Snapshot(ctx)
+//	for _, token := range batch {
+//		claims, err := snap.Verify(token)
+//		...
+//	}
+//
+// The key sets captured are those Prewarm fetches: each of
+// Config.AllowedIssuers if set, otherwise the Domain JWKS. Tokens routed to a
+// tenant key set by Config.TenantJWKSURL fail with ErrInvalidToken. All
+// other checks, including exp and nbf, apply as in VerifyToken.
+func (c *Client) Snapshot(ctx context.Context) (*VerifierSnapshot, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	v, err := c.verifier.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifierSnapshot{verifier: v}, nil
+}
+
+// Verify verifies token against the captured keys. Options relax or tighten
+// individual checks as in Client.VerifyToken.
+func (s *VerifierSnapshot) Verify(token string, opts ...VerifyOption) (*Claims, error) {
+	return s.verifier.Verify(context.Background(), token, opts...)
+}
+
+// snapshot returns a copy of v whose key sets are static copies of the ones
+// prewarm selects.
+func (v *JWTVerifier) snapshot(ctx context.Context) (*JWTVerifier, error) {
+	p := v.loadPolicy()
+	derived := *v
+	derived.policy = storedPolicy(p)
+	derived.issuerPolicy = nil
+	derived.extraJWKS = &jwksCaches{byURL: make(map[string]*jwksCache), static: true}
+	if p.allowedIssuers == nil {
+		jwks, err := v.jwks.snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		derived.jwks = jwks
+		return &derived, nil
+	}
+
+	derived.jwks = newStaticJWKSCache(nil, nil)
+	for _, iss := range p.issuers() {
+		url := jwksURL(iss)
+		jwks, err := v.extraJWKS.get(url).snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		derived.extraJWKS.byURL[url] = jwks
+	}
+	return &derived, nil
+}
@@ -0,0 +1,84 @@
+package hellojohn
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshot_VerifiesOffline(t *testing.T) {
+	srv, priv, fetches := newCountingJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, JWKSCacheTTL: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	snap, err := c.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot() error: %v", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Fatalf("JWKS fetched %d times by Snapshot; want 1", n)
+	}
+
+	// Expire the live cache and lift its rate limit, so any lookup through
+	// it would fetch again.
+	time.Sleep(5 * time.Millisecond)
+	c.verifier.jwks.minInterval = 0
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1"})
+	for i := 0; i < 3; i++ {
+		claims, err := snap.Verify(token)
+		if err != nil {
+			t.Fatalf("Verify() error: %v", err)
+		}
+		if claims.UserID != "user-1" {
+			t.Errorf("UserID = %q; want user-1", claims.UserID)
+		}
+	}
+
+	unknown := signTestTokenWithKID(t, priv, "rotated-key", map[string]interface{}{"sub": "user-1"})
+	if _, err := snap.Verify(unknown); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(unknown kid) error = %v; want ErrInvalidToken", err)
+	}
+
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("JWKS fetched %d times; want 1", n)
+	}
+}
+
+func TestSnapshot_AllowedIssuers(t *testing.T) {
+	srvA, privA, fetchesA := newCountingJWKSServer(t)
+	_, privB := newTestJWKSServer(t)
+	c, err := New(Config{Domain: "https://test.example.com", AllowedIssuers: []string{srvA.URL}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	snap, err := c.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot() error: %v", err)
+	}
+
+	token := signTestToken(t, privA, map[string]interface{}{"sub": "user-1", "iss": srvA.URL})
+	if _, err := snap.Verify(token); err != nil {
+		t.Errorf("Verify() error: %v", err)
+	}
+	forged := signTestToken(t, privB, map[string]interface{}{"sub": "user-1", "iss": srvA.URL})
+	if _, err := snap.Verify(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(forged) error = %v; want ErrInvalidToken", err)
+	}
+	if n := atomic.LoadInt32(fetchesA); n != 1 {
+		t.Errorf("issuer JWKS fetched %d times; want 1", n)
+	}
+}
+
+func TestSnapshot_ClosedClient(t *testing.T) {
+	c := newTestClient(t)
+	c.Close()
+	if _, err := c.Snapshot(context.Background()); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Snapshot() error = %v; want ErrClientClosed", err)
+	}
+}
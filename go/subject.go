@@ -0,0 +1,32 @@
+package hellojohn
+
+import "fmt"
+
+// UUIDSubjectValidator is a Config.SubjectValidator requiring sub to be a
+// UUID in the canonical 8-4-4-4-12 hexadecimal form, in either case.
+func UUIDSubjectValidator(sub string) error {
+	if !isUUID(sub) {
+		return fmt.Errorf("subject %q is not a UUID", sub)
+	}
+	return nil
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
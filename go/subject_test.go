@@ -0,0 +1,66 @@
+package hellojohn
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerify_SubjectValidator(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	tests := []struct {
+		name      string
+		validator func(string) error
+		sub       string
+		wantErr   bool
+	}{
+		{"valid UUID", UUIDSubjectValidator, "3f2b8c1e-9a4d-4e6f-8b2a-1c0d9e8f7a6b", false},
+		{"non-UUID", UUIDSubjectValidator, "user-1", true},
+		{"missing sub", UUIDSubjectValidator, "", true},
+		{"no validator", nil, "user-1", false},
+	}
+	for _, tt := range tests {
+		c, err := New(Config{Domain: srv.URL, SubjectValidator: tt.validator})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		payload := map[string]interface{}{}
+		if tt.sub != "" {
+			payload["sub"] = tt.sub
+		}
+		_, err = c.VerifyToken(context.Background(), signTestToken(t, priv, payload))
+		if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: VerifyToken() error = %v; want ErrInvalidToken", tt.name, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: VerifyToken() error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestUUIDSubjectValidator(t *testing.T) {
+	valid := []string{
+		"3f2b8c1e-9a4d-4e6f-8b2a-1c0d9e8f7a6b",
+		"3F2B8C1E-9A4D-4E6F-8B2A-1C0D9E8F7A6B",
+		"00000000-0000-0000-0000-000000000000",
+	}
+	invalid := []string{
+		"",
+		"3f2b8c1e9a4d4e6f8b2a1c0d9e8f7a6b",
+		"3f2b8c1e-9a4d-4e6f-8b2a-1c0d9e8f7a6",
+		"3f2b8c1e-9a4d-4e6f-8b2a-1c0d9e8f7a6bb",
+		"3f2b8c1e-9a4d-4e6f-8b2a_1c0d9e8f7a6b",
+		"{3f2b8c1e-9a4d-4e6f-8b2a-1c0d9e8f7a6}",
+		"3g2b8c1e-9a4d-4e6f-8b2a-1c0d9e8f7a6b",
+	}
+	for _, s := range valid {
+		if err := UUIDSubjectValidator(s); err != nil {
+			t.Errorf("UUIDSubjectValidator(%q) error: %v", s, err)
+		}
+	}
+	for _, s := range invalid {
+		if err := UUIDSubjectValidator(s); err == nil {
+			t.Errorf("UUIDSubjectValidator(%q) = nil; want error", s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package hellojohn
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// newDefaultHTTPClient returns the HTTP client used for JWKS and M2M requests
+// when no HTTPClient is configured. Each Client and M2MClient gets its own, so
+// closing one client's connections leaves the others' alone.
+//
+// http.DefaultClient is a poor default for an auth SDK: it has no overall
+// timeout, so a stalled JWKS endpoint ties up request goroutines for as long
+// as the caller's context allows (forever with context.Background), and its
+// transport keeps only two idle connections per host, which forces frequent
+// reconnects under load. It is also shared process-wide, so settings changed
+// by unrelated code leak into token verification.
+func newDefaultHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: DefaultTransport(),
+		Timeout:   10 * time.Second,
+	}
+}
+
+// defaultHTTPClient backs key set caches built without a client.
+var defaultHTTPClient = newDefaultHTTPClient()
+
+// DefaultTransport returns a new *http.Transport tuned for this SDK's traffic:
+// a small number of hosts (the HelloJohn domain) hit repeatedly. It keeps more
+// idle connections per host than net/http's default, bounds dial and TLS
+// handshake time, and attempts HTTP/2. Use it as a starting point for
+// Config.HTTPClient or M2MConfig.HTTPClient.
+func DefaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// setExtraHeaders adds the configured extra headers to req. It is called
+// before the SDK sets its own headers, which therefore take precedence.
+func setExtraHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// setRequestID sets the X-Request-Id header from req's context, if it
+// carries an ID.
+func setRequestID(req *http.Request) {
+	if id := RequestIDFromContext(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// httpClientOrDefault returns c, or defaultHTTPClient if c is nil.
+func httpClientOrDefault(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return defaultHTTPClient
+}
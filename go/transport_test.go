@@ -0,0 +1,88 @@
+package hellojohn
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport counts requests before delegating to DefaultTransport.
+type countingTransport struct {
+	calls int32
+	next  http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.calls, 1)
+	return t.next.RoundTrip(req)
+}
+
+func TestDefaultTransport_Settings(t *testing.T) {
+	tr := DefaultTransport()
+
+	if !tr.ForceAttemptHTTP2 {
+		t.Error("ForceAttemptHTTP2 = false; want true")
+	}
+	if tr.MaxIdleConnsPerHost != 32 {
+		t.Errorf("MaxIdleConnsPerHost = %d; want 32", tr.MaxIdleConnsPerHost)
+	}
+	if tr.MaxIdleConns != 100 {
+		t.Errorf("MaxIdleConns = %d; want 100", tr.MaxIdleConns)
+	}
+	if tr.IdleConnTimeout != 90*time.Second {
+		t.Errorf("IdleConnTimeout = %v; want 90s", tr.IdleConnTimeout)
+	}
+	if tr.TLSHandshakeTimeout != 5*time.Second {
+		t.Errorf("TLSHandshakeTimeout = %v; want 5s", tr.TLSHandshakeTimeout)
+	}
+	if tr.Proxy == nil {
+		t.Error("Proxy = nil; want ProxyFromEnvironment")
+	}
+}
+
+func TestDefaultTransport_ReturnsNewInstance(t *testing.T) {
+	if DefaultTransport() == DefaultTransport() {
+		t.Error("DefaultTransport() returned a shared instance; want a fresh one per call")
+	}
+}
+
+func TestConfig_HTTPClientUsedForJWKS(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	tr := &countingTransport{next: DefaultTransport()}
+	c, err := New(Config{Domain: srv.URL, HTTPClient: &http.Client{Transport: tr}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1"})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if n := atomic.LoadInt32(&tr.calls); n != 1 {
+		t.Errorf("custom transport calls = %d; want 1", n)
+	}
+}
+
+func TestM2MConfig_HTTPClientUsed(t *testing.T) {
+	srv := newMockTokenServer(t)
+	defer srv.Close()
+	tr := &countingTransport{next: DefaultTransport()}
+	client, err := NewM2MClient(M2MConfig{
+		Domain:       srv.URL,
+		ClientID:     "my-client",
+		ClientSecret: "my-secret",
+		HTTPClient:   &http.Client{Transport: tr},
+	})
+	if err != nil {
+		t.Fatalf("NewM2MClient() error: %v", err)
+	}
+
+	if _, err := client.GetToken(context.Background(), TokenRequest{}); err != nil {
+		t.Fatalf("GetToken() error: %v", err)
+	}
+	if n := atomic.LoadInt32(&tr.calls); n != 1 {
+		t.Errorf("custom transport calls = %d; want 1", n)
+	}
+}
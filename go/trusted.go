@@ -0,0 +1,141 @@
+package hellojohn
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderClaimMapping names the request headers that carry claims, as read by
+// TrustedHeaderAuth and written by InjectClaimHeaders. An empty field leaves
+// the corresponding claim out. List headers read by TrustedHeaderAuth may
+// separate values with commas and/or whitespace; InjectClaimHeaders writes
+// them comma-separated.
+type HeaderClaimMapping struct {
+	// UserHeader carries the subject. Required; requests without it get 401.
+	UserHeader string
+
+	// TenantHeader carries the tenant ID.
+	TenantHeader string
+
+	// ScopesHeader carries the scopes.
+	ScopesHeader string
+
+	// RolesHeader carries the roles.
+	RolesHeader string
+
+	// PermissionsHeader carries the permissions.
+	PermissionsHeader string
+}
+
+// OAuth2ProxyHeaders is the mapping for oauth2-proxy's default forwarded
+// headers.
+var OAuth2ProxyHeaders = HeaderClaimMapping{
+	UserHeader:  "X-Forwarded-User",
+	RolesHeader: "X-Forwarded-Groups",
+}
+
+// DefaultClaimHeaders is the mapping InjectClaimHeaders uses when
+// Config.ClaimHeaders is empty.
+var DefaultClaimHeaders = HeaderClaimMapping{
+	UserHeader:        "X-User-Id",
+	TenantHeader:      "X-Tenant-Id",
+	ScopesHeader:      "X-Scopes",
+	RolesHeader:       "X-Roles",
+	PermissionsHeader: "X-Permissions",
+}
+
+// TrustedHeaderAuth returns middleware that builds Claims from headers set by
+// an authenticating reverse proxy or sidecar and injects them into the
+// request context, in place of RequireAuth. Nothing is verified: any client
+// that can reach the service directly can set these headers and claim to be
+// anyone. Use it only when the service is reachable solely through a proxy
+// that always overwrites the mapped headers.
+//
+// Returns 401 if the user header is missing. The resulting Claims have no
+// Token and no expiry; Raw holds the sub and, if mapped, tid claims.
+func (c *Client) TrustedHeaderAuth(mapping HeaderClaimMapping) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := headerValue(r, mapping.UserHeader)
+			if user == "" {
+				c.writeError(w, http.StatusUnauthorized, "missing forwarded user")
+				return
+			}
+
+			claims := &Claims{
+				UserID:      user,
+				TenantID:    headerValue(r, mapping.TenantHeader),
+				Scopes:      headerList(r, mapping.ScopesHeader),
+				Roles:       headerList(r, mapping.RolesHeader),
+				Permissions: headerList(r, mapping.PermissionsHeader),
+				Raw:         map[string]interface{}{"sub": user},
+				sets:        new(claimSets),
+			}
+			if claims.TenantID != "" {
+				claims.Raw["tid"] = claims.TenantID
+			}
+
+			ctx := contextWithClaims(r.Context(), claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func headerValue(r *http.Request, name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(name))
+}
+
+// headerList splits every value of the named header on commas and whitespace.
+func headerList(r *http.Request, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var out []string
+	for _, v := range r.Header.Values(name) {
+		out = append(out, strings.FieldsFunc(v, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t'
+		})...)
+	}
+	return out
+}
+
+// InjectClaimHeaders sets the headers named by Config.ClaimHeaders (default
+// DefaultClaimHeaders) from the request's claims before calling next, for
+// proxies that forward requests to services expecting identity headers
+// rather than a JWT. Must be used after RequireAuth. Any client-supplied
+// values of those headers are removed first, so they cannot be spoofed; a
+// request without claims reaches next with the headers absent.
+func (c *Client) InjectClaimHeaders(next http.Handler) http.Handler {
+	mapping := c.config.ClaimHeaders
+	if mapping == (HeaderClaimMapping{}) {
+		mapping = DefaultClaimHeaders
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.WithContext(r.Context())
+		r2.Header = r.Header.Clone()
+		for _, name := range []string{mapping.UserHeader, mapping.TenantHeader, mapping.ScopesHeader, mapping.RolesHeader, mapping.PermissionsHeader} {
+			if name != "" {
+				r2.Header.Del(name)
+			}
+		}
+
+		if claims := ClaimsFromContext(r.Context()); claims != nil {
+			setHeader(r2.Header, mapping.UserHeader, claims.UserID)
+			setHeader(r2.Header, mapping.TenantHeader, claims.TenantID)
+			setHeader(r2.Header, mapping.ScopesHeader, strings.Join(claims.Scopes, ","))
+			setHeader(r2.Header, mapping.RolesHeader, strings.Join(claims.Roles, ","))
+			setHeader(r2.Header, mapping.PermissionsHeader, strings.Join(claims.Permissions, ","))
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// setHeader sets name to value unless either is empty.
+func setHeader(h http.Header, name, value string) {
+	if name != "" && value != "" {
+		h.Set(name, value)
+	}
+}
@@ -0,0 +1,140 @@
+package hellojohn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedHeaderAuth(t *testing.T) {
+	c := newTestClient(t)
+	mapping := HeaderClaimMapping{
+		UserHeader:        "X-Forwarded-User",
+		TenantHeader:      "X-Forwarded-Tenant",
+		ScopesHeader:      "X-Forwarded-Scopes",
+		RolesHeader:       "X-Forwarded-Groups",
+		PermissionsHeader: "X-Forwarded-Perms",
+	}
+
+	var seen *Claims
+	handler := c.TrustedHeaderAuth(mapping)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = ClaimsFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Forwarded-Tenant", "acme")
+	req.Header.Set("X-Forwarded-Scopes", "orders:read orders:write")
+	req.Header.Set("X-Forwarded-Groups", "admin, billing")
+	req.Header.Add("X-Forwarded-Groups", "ops")
+	req.Header.Set("X-Forwarded-Perms", "users:delete")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if seen == nil {
+		t.Fatal("handler saw no claims")
+	}
+	if seen.UserID != "alice" || seen.Subject() != "alice" || seen.TenantID != "acme" {
+		t.Errorf("UserID/TenantID = %q/%q; want alice/acme", seen.UserID, seen.TenantID)
+	}
+	if !seen.HasScope("orders:read") || !seen.HasScope("orders:write") {
+		t.Errorf("Scopes = %v", seen.Scopes)
+	}
+	if len(seen.Roles) != 3 || !seen.HasRole("admin") || !seen.HasRole("billing") || !seen.HasRole("ops") {
+		t.Errorf("Roles = %v; want [admin billing ops]", seen.Roles)
+	}
+	if !seen.HasPermission("users:delete") {
+		t.Errorf("Permissions = %v", seen.Permissions)
+	}
+}
+
+func TestTrustedHeaderAuth_MissingUser(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.TrustedHeaderAuth(OAuth2ProxyHeaders)(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-Groups", "admin")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestTrustedHeaderAuth_WithRequireRole(t *testing.T) {
+	c := newTestClient(t)
+	handler := c.TrustedHeaderAuth(OAuth2ProxyHeaders)(c.RequireRole("admin")(okHandler))
+
+	for groups, want := range map[string]int{"admin": http.StatusOK, "viewer": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		req.Header.Set("X-Forwarded-Groups", groups)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("groups %q: status = %d; want %d", groups, rec.Code, want)
+		}
+	}
+}
+
+func TestInjectClaimHeaders(t *testing.T) {
+	c := newTestClient(t)
+	claims := &Claims{UserID: "user-1", TenantID: "acme", Scopes: []string{"read", "write"}, Roles: []string{"admin"}}
+
+	var got http.Header
+	handler := claimsInjector(claims)(c.InjectClaimHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User-Id", "spoofed")
+	req.Header.Add("X-User-Id", "spoofed-again")
+	req.Header.Set("X-Permissions", "everything")
+	req.Header.Set("X-Other", "kept")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := map[string]string{
+		"X-User-Id":   "user-1",
+		"X-Tenant-Id": "acme",
+		"X-Scopes":    "read,write",
+		"X-Roles":     "admin",
+		"X-Other":     "kept",
+	}
+	for name, v := range want {
+		if vals := got.Values(name); len(vals) != 1 || vals[0] != v {
+			t.Errorf("%s = %q; want [%q]", name, vals, v)
+		}
+	}
+	if v := got.Values("X-Permissions"); len(v) != 0 {
+		t.Errorf("X-Permissions = %q; want spoofed value removed", v)
+	}
+	if req.Header.Get("X-User-Id") != "spoofed" {
+		t.Error("InjectClaimHeaders modified the caller's request headers")
+	}
+}
+
+func TestInjectClaimHeaders_CustomMappingWithoutClaims(t *testing.T) {
+	c, err := New(Config{
+		Domain:       "https://test.example.com",
+		ClaimHeaders: HeaderClaimMapping{UserHeader: "X-Auth-Subject"},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	var got http.Header
+	handler := c.InjectClaimHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Auth-Subject", "spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if v := got.Get("X-Auth-Subject"); v != "" {
+		t.Errorf("X-Auth-Subject = %q; want removed without claims", v)
+	}
+}
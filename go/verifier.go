@@ -1,37 +1,418 @@
 package hellojohn
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/ed25519"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // JWTVerifier handles JWT verification using JWKS.
 type JWTVerifier struct {
-	jwks     *jwksCache
-	audience string
+	jwks          *jwksCache
+	maxTokenBytes int
+
+	// policy holds the checks Client.SetAudiences and SetAllowedIssuers
+	// replace at runtime. Verify loads it once, so each call sees a single
+	// version throughout.
+	policy *atomic.Pointer[verifyPolicy]
+
+	// issuerPolicy, set on verifiers derived with withAudience, is the
+	// policy of the verifier they came from. Its allowedIssuers replace
+	// policy's, so SetAllowedIssuers on the base reaches derived clients.
+	issuerPolicy *atomic.Pointer[verifyPolicy]
+
+	// audienceFunc and deprecatedAudiences are accepted in addition to the
+	// policy's audiences.
+	audienceFunc         func() []string
+	deprecatedAudiences  []string
+	onDeprecatedAudience func(aud string)
+
+	// expLeeway and nbfLeeway are the resolved clock skew tolerances.
+	expLeeway time.Duration
+	nbfLeeway time.Duration
+	now       func() time.Time
+
+	// issuedCutoff rejects tokens issued before it; zero disables.
+	issuedCutoff time.Time
+
+	tenantJWKSURL  func(tid string) string
+	allowedTenants map[string]bool
+	extraJWKS      *jwksCaches
+
+	// issuerDomain, when set, is the Domain every iss must fall under.
+	issuerDomain string
+
+	authorizedParty  string
+	subjectValidator func(sub string) error
+	preVerifyHook    func(header TokenHeader) error
+
+	rolesClaim     string
+	rolesExtractor func(payload map[string]interface{}) []string
+	rawNumberMode  RawNumberMode
+	scopeStrategy  ScopeClaimStrategy
+
+	allowMissingKid bool
+	tolerantBase64  bool
+
+	// devBypass accepts unsigned dev tokens; see Config.InsecureDevBypass.
+	devBypass bool
+
+	trace func(VerifyTrace)
+}
+
+// verifyPolicy is the runtime-replaceable part of a JWTVerifier. It is never
+// modified once stored.
+type verifyPolicy struct {
+	audience  string
+	audiences []string
+
+	// allowedIssuers is nil when any issuer is accepted.
+	allowedIssuers map[string]bool
+}
+
+func newVerifyPolicy(audience string, audiences, allowedIssuers []string) *verifyPolicy {
+	p := &verifyPolicy{audience: audience, audiences: audiences}
+	if len(allowedIssuers) > 0 {
+		p.allowedIssuers = make(map[string]bool, len(allowedIssuers))
+		for _, iss := range allowedIssuers {
+			p.allowedIssuers[strings.TrimRight(iss, "/")] = true
+		}
+	}
+	return p
+}
+
+// issuers returns the allowed issuers in sorted order.
+func (p *verifyPolicy) issuers() []string {
+	issuers := make([]string, 0, len(p.allowedIssuers))
+	for iss := range p.allowedIssuers {
+		issuers = append(issuers, iss)
+	}
+	sort.Strings(issuers)
+	return issuers
+}
+
+func storedPolicy(p *verifyPolicy) *atomic.Pointer[verifyPolicy] {
+	ptr := new(atomic.Pointer[verifyPolicy])
+	ptr.Store(p)
+	return ptr
+}
+
+// updatePolicy stores a copy of the policy in ptr modified by fn. fn may run
+// more than once if updates race.
+func updatePolicy(ptr *atomic.Pointer[verifyPolicy], fn func(p *verifyPolicy)) {
+	for {
+		old := ptr.Load()
+		p := *old
+		fn(&p)
+		if ptr.CompareAndSwap(old, &p) {
+			return
+		}
+	}
+}
+
+// issuerSource returns the policy pointer v reads allowed issuers from.
+func (v *JWTVerifier) issuerSource() *atomic.Pointer[verifyPolicy] {
+	if v.issuerPolicy != nil {
+		return v.issuerPolicy
+	}
+	return v.policy
 }
 
-func newJWTVerifier(domain, audience string, cacheTTL time.Duration) *JWTVerifier {
-	return &JWTVerifier{
-		jwks:     newJWKSCache(domain, cacheTTL),
-		audience: audience,
+// loadPolicy returns the policy in effect, with the allowed issuers of the
+// verifier v was derived from, if any.
+func (v *JWTVerifier) loadPolicy() *verifyPolicy {
+	p := v.policy.Load()
+	if v.issuerPolicy == nil {
+		return p
 	}
+	merged := *p
+	merged.allowedIssuers = v.issuerPolicy.Load().allowedIssuers
+	return &merged
+}
+
+// maxExtraJWKSCaches bounds the per-tenant and per-issuer JWKS caches. The
+// tenant is read from the unverified token, so without a bound made-up tids
+// could grow the set without limit. When full, the least recently used cache
+// is evicted.
+const maxExtraJWKSCaches = 256
+
+// jwksCaches holds the per-tenant and per-issuer JWKS caches, keyed by JWKS
+// URL. It is shared by verifiers derived from the same client.
+type jwksCaches struct {
+	mu    sync.Mutex
+	byURL map[string]*jwksCache
+	// lastUsed orders byURL for eviction by the tick of each URL's last get.
+	lastUsed   map[string]uint64
+	tick       uint64
+	ttl        time.Duration
+	staleGrace time.Duration
+	client     *http.Client
+	headers    map[string]string
+
+	// static sets, as in a snapshot, never fetch: a URL without a cache
+	// gets an empty static one.
+	static bool
+}
+
+// get returns the cache for url, creating it on first use.
+func (t *jwksCaches) get(url string) *jwksCache {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cache, ok := t.byURL[url]
+	if !ok && t.static {
+		return newStaticJWKSCache(nil, nil)
+	}
+	if !ok {
+		if len(t.byURL) >= maxExtraJWKSCaches {
+			t.evictOldest()
+		}
+		cache = newJWKSCache(url, t.ttl)
+		cache.client = t.client
+		cache.headers = t.headers
+		cache.staleGrace = t.staleGrace
+		t.byURL[url] = cache
+	}
+	if t.lastUsed == nil {
+		t.lastUsed = make(map[string]uint64)
+	}
+	t.tick++
+	t.lastUsed[url] = t.tick
+	return cache
+}
+
+// evictOldest removes the least recently used cache. The caller holds t.mu.
+func (t *jwksCaches) evictOldest() {
+	oldest, oldestTick := "", uint64(0)
+	for url := range t.byURL {
+		if tick := t.lastUsed[url]; oldest == "" || tick < oldestTick {
+			oldest, oldestTick = url, tick
+		}
+	}
+	delete(t.byURL, oldest)
+	delete(t.lastUsed, oldest)
+}
+
+// forgetUnfetched removes cache if no fetch of it has ever succeeded, so a
+// key set URL that never served keys, such as one for a made-up tenant, is
+// not kept.
+func (t *jwksCaches) forgetUnfetched(cache *jwksCache) {
+	cache.mu.RLock()
+	fetched := !cache.lastFetch.IsZero()
+	cache.mu.RUnlock()
+	if fetched || cache.static {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.byURL[cache.url] == cache {
+		delete(t.byURL, cache.url)
+		delete(t.lastUsed, cache.url)
+	}
+}
+
+func newJWTVerifier(cfg Config) *JWTVerifier {
+	v := &JWTVerifier{
+		jwks:                 newJWKSCache(jwksURL(cfg.Domain), cfg.JWKSCacheTTL),
+		maxTokenBytes:        cfg.MaxTokenBytes,
+		policy:               storedPolicy(newVerifyPolicy(cfg.Audience, cfg.Audiences, cfg.AllowedIssuers)),
+		audienceFunc:         cfg.AudienceFunc,
+		deprecatedAudiences:  cfg.DeprecatedAudiences,
+		onDeprecatedAudience: cfg.OnDeprecatedAudience,
+		now:                  time.Now,
+		issuedCutoff:         cfg.RejectTokensIssuedBefore,
+		tenantJWKSURL:        cfg.TenantJWKSURL,
+		rolesClaim:           cfg.ClaimMapping.RolesClaim,
+		rolesExtractor:       cfg.RolesExtractor,
+		rawNumberMode:        cfg.RawNumberMode,
+		scopeStrategy:        cfg.ScopeClaimStrategy,
+		allowMissingKid:      cfg.AllowMissingKid,
+		tolerantBase64:       cfg.TolerantBase64,
+		authorizedParty:      cfg.ExpectedAuthorizedParty,
+		subjectValidator:     cfg.SubjectValidator,
+		preVerifyHook:        cfg.PreVerifyHook,
+		trace:                cfg.Trace,
+		extraJWKS: &jwksCaches{
+			byURL:      make(map[string]*jwksCache),
+			ttl:        cfg.JWKSCacheTTL,
+			staleGrace: cfg.JWKSStaleWhileRevalidate,
+			client:     cfg.HTTPClient,
+			headers:    cfg.ExtraHeaders,
+		},
+	}
+	v.jwks.client = cfg.HTTPClient
+	v.jwks.headers = cfg.ExtraHeaders
+	v.jwks.staleGrace = cfg.JWKSStaleWhileRevalidate
+	v.expLeeway, v.nbfLeeway = leeways(cfg.ClockSkew)
+	if cfg.RequireIssuerMatchesDomain {
+		v.issuerDomain = cfg.Domain
+	}
+	if len(cfg.AllowedTenants) > 0 {
+		v.allowedTenants = make(map[string]bool, len(cfg.AllowedTenants))
+		for _, tid := range cfg.AllowedTenants {
+			v.allowedTenants[tid] = true
+		}
+	}
+	return v
+}
+
+// prewarm refreshes the key sets keySet will select for tokens without a
+// tenant, returning the first error.
+func (v *JWTVerifier) prewarm(ctx context.Context) error {
+	p := v.loadPolicy()
+	if p.allowedIssuers == nil {
+		return v.jwks.refresh(ctx)
+	}
+	for _, iss := range p.issuers() {
+		if err := v.extraJWKS.get(jwksURL(iss)).refresh(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyWithJWKS verifies a token against an explicit JWKS document without
+// any network access. The key is resolved by the token's kid. Audience and
+// issuer are not checked; DefaultMaxTokenBytes applies.
+func VerifyWithJWKS(ctx context.Context, token string, jwksJSON []byte, opts ...VerifyOption) (*Claims, error) {
+	keys, unsupported, err := parseJWKS(jwksJSON)
+	if err != nil {
+		return nil, fmt.Errorf("hellojohn: invalid JWKS: %w", err)
+	}
+	v := &JWTVerifier{
+		jwks:          newStaticJWKSCache(keys, unsupported),
+		policy:        storedPolicy(&verifyPolicy{}),
+		maxTokenBytes: DefaultMaxTokenBytes,
+		nbfLeeway:     DefaultNotBeforeSkew,
+		now:           time.Now,
+	}
+	return v.Verify(ctx, token, opts...)
+}
+
+// leeways resolves Config.ClockSkew into the exp and nbf tolerances. Nil
+// keeps exp strict with DefaultNotBeforeSkew on nbf; a negative skew is
+// treated as zero.
+func leeways(skew *time.Duration) (exp, nbf time.Duration) {
+	if skew == nil {
+		return 0, DefaultNotBeforeSkew
+	}
+	if *skew < 0 {
+		return 0, 0
+	}
+	return *skew, *skew
+}
+
+// withAudience returns a copy of the verifier expecting only the given audience.
+// The copy shares all JWKS caches with v.
+func (v *JWTVerifier) withAudience(audience string) *JWTVerifier {
+	derived := *v
+	derived.policy = storedPolicy(&verifyPolicy{audience: audience})
+	derived.issuerPolicy = v.issuerSource()
+	derived.audienceFunc = nil
+	derived.deprecatedAudiences = nil
+	return &derived
+}
+
+// keySet returns the JWKS cache to verify the token against. The tid and iss
+// claims are peeked from the unverified payload, in order of precedence:
+//
+//   - with TenantJWKSURL and a tid claim, the tenant's JWKS URL;
+//   - with AllowedIssuers, the issuer's own JWKS (iss must be allowed);
+//   - otherwise the Domain JWKS.
+//
+// Unverified claims only choose where keys come from; disallowed issuers and
+// unknown tenants are rejected before anything is fetched.
+func (v *JWTVerifier) keySet(payloadSegment string, p *verifyPolicy) (*jwksCache, error) {
+	if v.tenantJWKSURL == nil && p.allowedIssuers == nil {
+		return v.jwks, nil
+	}
+
+	payloadBytes, err := v.decodeSegment(payloadSegment)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid payload encoding", ErrInvalidToken)
+	}
+	var unverified struct {
+		Tid string `json:"tid"`
+		Iss string `json:"iss"`
+	}
+	if err := json.Unmarshal(payloadBytes, &unverified); err != nil {
+		return nil, fmt.Errorf("%w: invalid payload JSON", ErrInvalidToken)
+	}
+
+	iss := strings.TrimRight(unverified.Iss, "/")
+	if p.allowedIssuers != nil && !p.allowedIssuers[iss] {
+		return nil, fmt.Errorf("%w: issuer %q not allowed", ErrInvalidToken, unverified.Iss)
+	}
+
+	if v.tenantJWKSURL != nil && unverified.Tid != "" {
+		url := v.tenantJWKSURL(unverified.Tid)
+		if url == "" {
+			return nil, fmt.Errorf("%w: unknown tenant %q", ErrInvalidToken, unverified.Tid)
+		}
+		return v.extraJWKS.get(url), nil
+	}
+
+	if p.allowedIssuers != nil {
+		return v.extraJWKS.get(jwksURL(iss)), nil
+	}
+	return v.jwks, nil
 }
 
 // Verify parses and verifies a JWT token, returning the claims if valid.
-func (v *JWTVerifier) Verify(ctx context.Context, tokenStr string) (*Claims, error) {
+func (v *JWTVerifier) Verify(ctx context.Context, tokenStr string, opts ...VerifyOption) (claims *Claims, err error) {
+	o := newVerifyOptions(opts)
+
+	var tr VerifyTrace
+	var timer phaseTimer
+	if v.trace != nil {
+		timer.start(&tr.Decode)
+		defer func() {
+			timer.stop()
+			tr.Err = err
+			v.trace(tr)
+		}()
+	}
+
+	// No JWT starts with "Bearer ", so a whole Authorization header value
+	// passed by mistake is unambiguous.
+	if len(tokenStr) > len("Bearer ") && strings.EqualFold(tokenStr[:len("Bearer ")], "Bearer ") {
+		tokenStr = tokenStr[len("Bearer "):]
+	}
+
+	if v.maxTokenBytes > 0 && len(tokenStr) > v.maxTokenBytes {
+		return nil, fmt.Errorf("%w: token too large", ErrInvalidToken)
+	}
+
+	// A signed JWT has three segments, so it never matches the prefix.
+	if v.devBypass && strings.HasPrefix(tokenStr, devTokenPrefix) && strings.Count(tokenStr, ".") == 1 {
+		return v.verifyDevToken(tokenStr)
+	}
+
+	// A JSON-serialized JWS (RFC 7515 section 7.2) is a JSON object rather
+	// than dot-separated segments; name it so the sender can be fixed.
+	if strings.HasPrefix(strings.TrimSpace(tokenStr), "{") {
+		return nil, fmt.Errorf("%w: JSON-serialized JWS is not supported; use compact form", ErrInvalidToken)
+	}
+
 	parts := strings.Split(tokenStr, ".")
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
 	}
 
 	// 1. Decode header
-	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	headerBytes, err := v.decodeSegment(parts[0])
 	if err != nil {
 		return nil, fmt.Errorf("%w: invalid header encoding", ErrInvalidToken)
 	}
@@ -40,102 +421,414 @@ func (v *JWTVerifier) Verify(ctx context.Context, tokenStr string) (*Claims, err
 		Alg string `json:"alg"`
 		Kid string `json:"kid"`
 		Typ string `json:"typ"`
+		// B64 and Crit are checked only to reject RFC 7797 unencoded-payload
+		// tokens, whose payload segment is not base64url.
+		B64  *bool    `json:"b64"`
+		Crit []string `json:"crit"`
 	}
 	if err := json.Unmarshal(headerBytes, &header); err != nil {
 		return nil, fmt.Errorf("%w: invalid header JSON", ErrInvalidToken)
 	}
 
-	if header.Alg != "EdDSA" {
-		return nil, fmt.Errorf("%w: unsupported algorithm %q, expected EdDSA", ErrInvalidToken, header.Alg)
+	if header.B64 != nil && !*header.B64 {
+		return nil, fmt.Errorf("%w: unencoded payload (b64=false) is not supported", ErrInvalidToken)
+	}
+	// No crit extensions are understood, so RFC 7515 requires rejecting any.
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("%w: unsupported critical header parameters %v", ErrInvalidToken, header.Crit)
+	}
+
+	if !jwsAlgorithms[header.Alg] {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
 	}
 
-	// 2. Get public key from JWKS cache
-	pubKey, err := v.jwks.GetKey(ctx, header.Kid)
+	if v.preVerifyHook != nil {
+		if err := v.preVerifyHook(TokenHeader{Alg: header.Alg, Kid: header.Kid, Typ: header.Typ}); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+
+	timer.next(&tr.KeyLookup)
+
+	// 2. Get public key from JWKS cache. Without a kid, every cached key is
+	// a candidate if AllowMissingKid is set.
+	policy := v.loadPolicy()
+	keys, err := v.keySet(parts[1], policy)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []ed25519.PublicKey
+	if header.Kid == "" && v.allowMissingKid {
+		candidates, err = keys.Keys(ctx)
+	} else {
+		var pubKey ed25519.PublicKey
+		pubKey, err = keys.GetKey(ctx, header.Kid)
+		candidates = []ed25519.PublicKey{pubKey}
+	}
 	if err != nil {
+		if keys != v.jwks {
+			v.extraJWKS.forgetUnfetched(keys)
+		}
 		return nil, err
 	}
+	for _, key := range candidates {
+		if err := checkKeyAlgorithm(header.Alg, key); err != nil {
+			return nil, err
+		}
+	}
+	timer.next(&tr.Signature)
 
 	// 3. Verify signature
 	signingInput := parts[0] + "." + parts[1]
-	signatureBytes, err := base64.RawURLEncoding.DecodeString(parts[2])
+	signatureBytes, err := v.decodeSegment(parts[2])
 	if err != nil {
 		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
 	}
 
-	if !ed25519.Verify(pubKey, []byte(signingInput), signatureBytes) {
+	verified := false
+	for _, key := range candidates {
+		if ed25519.Verify(key, []byte(signingInput), signatureBytes) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
 		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
 	}
+	timer.next(&tr.Decode)
 
 	// 4. Decode payload
-	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	payloadBytes, err := v.decodeSegment(parts[1])
 	if err != nil {
 		return nil, fmt.Errorf("%w: invalid payload encoding", ErrInvalidToken)
 	}
 
-	var payload map[string]interface{}
-	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+	payload, err := decodePayload(payloadBytes)
+	if err != nil {
 		return nil, fmt.Errorf("%w: invalid payload JSON", ErrInvalidToken)
 	}
+	timer.next(&tr.ClaimValidation)
 
 	// 5. Validate standard claims
-	now := time.Now().Unix()
+	now := v.now().Unix()
 
-	exp, _ := toInt64(payload["exp"])
-	if exp > 0 && exp < now {
+	exp, err := numericDateClaim(payload, "exp")
+	if err != nil {
+		return nil, err
+	}
+	if exp > 0 && now > exp+int64(v.expLeeway/time.Second) && !o.skipExpiry {
 		return nil, ErrTokenExpired
 	}
 
-	nbf, _ := toInt64(payload["nbf"])
-	if nbf > 0 && nbf > now+30 { // 30s clock tolerance
-		return nil, fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	nbf, err := numericDateClaim(payload, "nbf")
+	if err != nil {
+		return nil, err
+	}
+	if nbf > 0 && nbf > now+int64(v.nbfLeeway/time.Second) {
+		return nil, fmt.Errorf("%w: token not yet valid (nbf is %ds in the future)", ErrInvalidToken, nbf-now)
 	}
 
-	if v.audience != "" {
-		if !matchesAudience(payload["aud"], v.audience) {
-			return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+	if !v.issuedCutoff.IsZero() {
+		iat, err := numericDateClaim(payload, "iat")
+		if err != nil {
+			return nil, err
+		}
+		if time.Unix(iat, 0).Before(v.issuedCutoff) {
+			return nil, fmt.Errorf("%w: token issued before %s", ErrInvalidToken, v.issuedCutoff.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if err := v.checkAudience(payload["aud"], policy); err != nil {
+		return nil, err
+	}
+
+	if v.issuerDomain != "" && !issuerUnderDomain(toString(payload["iss"]), v.issuerDomain) {
+		return nil, fmt.Errorf("%w: issuer %q does not match domain", ErrInvalidToken, toString(payload["iss"]))
+	}
+
+	azp := toString(payload["azp"])
+	if v.authorizedParty != "" && azp != v.authorizedParty {
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidToken)
+	}
+
+	tid := toString(payload["tid"])
+	if v.allowedTenants != nil && !v.allowedTenants[tid] {
+		return nil, fmt.Errorf("%w: %w: tenant %q", ErrForbidden, ErrTenantNotAllowed, tid)
+	}
+
+	if v.subjectValidator != nil {
+		if err := v.subjectValidator(toString(payload["sub"])); err != nil {
+			return nil, fmt.Errorf("%w: invalid subject: %w", ErrInvalidToken, err)
 		}
 	}
 
 	// 6. Build claims
+	claims = v.buildClaims(payload, payloadBytes, tokenStr)
+	claims.Header = TokenHeader{Alg: header.Alg, Kid: header.Kid, Typ: header.Typ}
+	return claims, nil
+}
+
+// buildClaims builds Claims from a validated payload. Time claims that were
+// validated are read the same way here.
+func (v *JWTVerifier) buildClaims(payload map[string]interface{}, payloadBytes []byte, tokenStr string) *Claims {
 	amr := extractStringSlice(payload["amr"])
 	isM2M := containsString(amr, "client")
 
 	claims := &Claims{
-		UserID:      toString(payload["sub"]),
-		TenantID:    toString(payload["tid"]),
-		Scopes:      extractScopes(payload),
-		Roles:       extractStringSlice(payload["roles"]),
-		Permissions: extractStringSlice(payload["perms"]),
-		IsM2M:       isM2M,
-		IssuedAt:    toInt64OrZero(payload["iat"]),
-		ExpiresAt:   exp,
-		Issuer:      toString(payload["iss"]),
-		Raw:         payload,
-		Token:       tokenStr,
+		UserID:           toString(payload["sub"]),
+		TenantID:         toString(payload["tid"]),
+		Scopes:           extractScopesWith(payload, v.scopeStrategy),
+		Roles:            v.extractRoles(payload),
+		Permissions:      extractStringSlice(payload["perms"]),
+		IsM2M:            isM2M,
+		IssuedAt:         toNumericDateOrZero(payload["iat"]),
+		ExpiresAt:        toNumericDateOrZero(payload["exp"]),
+		NotBefore:        toNumericDateOrZero(payload["nbf"]),
+		AuthTime:         toNumericDateOrZero(payload["auth_time"]),
+		Issuer:           toString(payload["iss"]),
+		AuthorizedParty:  toString(payload["azp"]),
+		AuthMethods:      amr,
+		AuthContextClass: toString(payload["acr"]),
+		Actor:            extractActor(payload["act"], 0),
+		Raw:              payload,
+		Token:            tokenStr,
+		rawJSON:          payloadBytes,
+		sets:             new(claimSets),
 	}
 
 	if isM2M {
 		claims.ClientID = claims.UserID
 	}
+	// Every claim above was read exactly; only Raw follows the mode.
+	if v.rawNumberMode == RawFloat64 {
+		floatNumbers(payload)
+	}
+	return claims
+}
 
-	return claims, nil
+// issuerUnderDomain reports whether iss is domain or a path below it. A plain
+// prefix test would also accept "https://auth.example.com.evil.test".
+func issuerUnderDomain(iss, domain string) bool {
+	iss = strings.TrimRight(iss, "/")
+	return iss == domain || strings.HasPrefix(iss, domain+"/")
+}
+
+// decodeSegment decodes a base64url token segment, falling back to standard
+// base64 with and without padding when tolerantBase64 is set.
+func (v *JWTVerifier) decodeSegment(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil || !v.tolerantBase64 {
+		return b, err
+	}
+	if b, stdErr := base64.StdEncoding.DecodeString(s); stdErr == nil {
+		return b, nil
+	}
+	if b, stdErr := base64.RawStdEncoding.DecodeString(s); stdErr == nil {
+		return b, nil
+	}
+	return nil, err
+}
+
+// extractRoles reads Claims.Roles with the configured RolesExtractor, or from
+// the roles claim named by ClaimMapping.
+func (v *JWTVerifier) extractRoles(payload map[string]interface{}) []string {
+	if v.rolesExtractor != nil {
+		return v.rolesExtractor(payload)
+	}
+	return extractStringSlice(lookupClaim(payload, v.rolesClaimName()))
+}
+
+func (v *JWTVerifier) rolesClaimName() string {
+	if v.rolesClaim == "" {
+		return "roles"
+	}
+	return v.rolesClaim
+}
+
+// lookupClaim returns payload[name] if present, and otherwise treats name as
+// a dot-separated path through nested objects. Returns nil if neither
+// resolves.
+func lookupClaim(payload map[string]interface{}, name string) interface{} {
+	if v, ok := payload[name]; ok {
+		return v
+	}
+	if !strings.Contains(name, ".") {
+		return nil
+	}
+	var cur interface{} = payload
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[key]
+	}
+	return cur
+}
+
+// jwsAlgorithms are the signature algorithms registered in RFC 7518 and
+// RFC 8037. Anything else, including "none", is rejected before key lookup;
+// a registered algorithm must then also match the key (checkKeyAlgorithm).
+var jwsAlgorithms = map[string]bool{
+	"HS256": true, "HS384": true, "HS512": true,
+	"RS256": true, "RS384": true, "RS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+	"EdDSA": true,
+}
+
+// checkKeyAlgorithm rejects a header alg that is not valid for the key's
+// type, so a key can never be used with an algorithm it was not issued for.
+func checkKeyAlgorithm(alg string, key crypto.PublicKey) error {
+	var want string
+	switch key.(type) {
+	case ed25519.PublicKey:
+		want = "EdDSA"
+	default:
+		return fmt.Errorf("%w: %w: unsupported key type %T", ErrInvalidToken, ErrAlgorithmMismatch, key)
+	}
+	if alg != want {
+		return fmt.Errorf("%w: %w: alg %q used with a key that requires %s", ErrInvalidToken, ErrAlgorithmMismatch, alg, want)
+	}
+	return nil
+}
+
+// decodePayload decodes a JWT payload, keeping numbers as json.Number so that
+// integers beyond 2^53 are read exactly.
+func decodePayload(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var payload map[string]interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after payload object")
+	}
+	return payload, nil
+}
+
+// floatNumbers replaces the json.Number values in v, recursively and in
+// place, with float64.
+func floatNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v
+		}
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = floatNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = floatNumbers(e)
+		}
+	}
+	return v
+}
+
+// checkAudience accepts aud if it matches Audience, any of Audiences or the
+// current AudienceFunc result, or any of DeprecatedAudiences. A match on a
+// deprecated audience alone reports it through onDeprecatedAudience. No
+// configured audiences means no check; a set AudienceFunc always enables it.
+func (v *JWTVerifier) checkAudience(aud interface{}, p *verifyPolicy) error {
+	if p.audience == "" && len(p.audiences) == 0 && v.audienceFunc == nil && len(v.deprecatedAudiences) == 0 {
+		return nil
+	}
+	if p.audience != "" && matchesAudience(aud, p.audience) {
+		return nil
+	}
+	audiences := p.audiences
+	if v.audienceFunc != nil {
+		audiences = unionStrings(audiences, v.audienceFunc())
+	}
+	for _, expected := range audiences {
+		if matchesAudience(aud, expected) {
+			return nil
+		}
+	}
+	for _, deprecated := range v.deprecatedAudiences {
+		if matchesAudience(aud, deprecated) {
+			if v.onDeprecatedAudience != nil {
+				v.onDeprecatedAudience(deprecated)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+}
+
+// maxActorDepth bounds how much of a nested act chain is parsed.
+const maxActorDepth = 8
+
+// extractActor parses an act claim object, following nested act claims.
+func extractActor(v interface{}, depth int) *Actor {
+	act, ok := v.(map[string]interface{})
+	if !ok || depth >= maxActorDepth {
+		return nil
+	}
+	return &Actor{
+		Subject: toString(act["sub"]),
+		Issuer:  toString(act["iss"]),
+		Actor:   extractActor(act["act"], depth+1),
+	}
 }
 
 // extractScopes handles both "scp" (array) and "scope" (space-separated string) formats.
 func extractScopes(payload map[string]interface{}) []string {
-	if scp, ok := payload["scp"]; ok {
-		return extractStringSlice(scp)
-	}
-	if scope, ok := payload["scope"]; ok {
-		if s, ok := scope.(string); ok {
-			parts := strings.Fields(s)
-			if len(parts) > 0 {
-				return parts
+	return extractScopesWith(payload, ScpPrecedence)
+}
+
+// extractScopesWith is extractScopes with an explicit rule for tokens that
+// carry both scp and scope.
+func extractScopesWith(payload map[string]interface{}, strategy ScopeClaimStrategy) []string {
+	scp, hasScp := payload["scp"]
+	scope, hasScope := payload["scope"]
+	switch {
+	case hasScp && hasScope && strategy == ScopePrecedence:
+		return extractScopeList(scope)
+	case hasScp && hasScope && strategy == Union:
+		return unionStrings(extractScopeList(scp), extractScopeList(scope))
+	case hasScp:
+		return extractScopeList(scp)
+	case hasScope:
+		return extractScopeList(scope)
+	}
+	return nil
+}
+
+// unionStrings returns the distinct elements of a followed by those of b.
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
 			}
 		}
-		return extractStringSlice(scope)
 	}
-	return nil
+	return out
+}
+
+// extractScopeList is like extractStringSlice but also splits each array
+// element on whitespace, so a malformed ["read write"] yields [read write].
+func extractScopeList(v interface{}) []string {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return extractStringSlice(v)
+	}
+	result := make([]string, 0, len(arr))
+	for _, item := range arr {
+		if s, ok := item.(string); ok {
+			result = append(result, strings.Fields(s)...)
+		}
+	}
+	return result
 }
 
 func extractStringSlice(v interface{}) []string {
@@ -184,14 +877,67 @@ func toString(v interface{}) string {
 func toInt64(v interface{}) (int64, bool) {
 	switch n := v.(type) {
 	case float64:
-		return int64(n), true
+		return floatToInt64(n)
 	case json.Number:
-		i, err := n.Int64()
-		return i, err == nil
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return floatToInt64(f)
+	}
+	return 0, false
+}
+
+// floatToInt64 truncates f to an int64, failing for NaN and values outside
+// the int64 range, whose conversion Go leaves implementation-defined.
+// float64(math.MaxInt64) rounds up to 2^63, hence >= for the upper bound.
+func floatToInt64(f float64) (int64, bool) {
+	if math.IsNaN(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toNumericDate converts a NumericDate claim to Unix seconds. Besides JSON
+// numbers it accepts numeric strings, which some issuers emit.
+func toNumericDate(v interface{}) (int64, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return toInt64(v)
+	}
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return floatToInt64(f)
 	}
 	return 0, false
 }
 
+func toNumericDateOrZero(v interface{}) int64 {
+	n, _ := toNumericDate(v)
+	return n
+}
+
+// numericDateClaim reads a time claim from the payload. An absent claim yields
+// zero; a claim that is present but not a valid, positive NumericDate is an
+// error so that a garbled exp can never disable the expiry check.
+func numericDateClaim(payload map[string]interface{}, name string) (int64, error) {
+	v, present := payload[name]
+	if !present {
+		return 0, nil
+	}
+	n, ok := toNumericDate(v)
+	if !ok || n <= 0 {
+		return 0, fmt.Errorf("%w: invalid %s claim", ErrInvalidToken, name)
+	}
+	return n, nil
+}
+
 func toInt64OrZero(v interface{}) int64 {
 	n, _ := toInt64(v)
 	return n
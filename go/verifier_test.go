@@ -1,10 +1,1258 @@
 package hellojohn
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+const testKID = "test-key"
+
+// newTestJWKSServer starts a server publishing a fresh Ed25519 key under
+// testKID and returns it together with the matching private key.
+func newTestJWKSServer(t *testing.T) (*httptest.Server, ed25519.PrivateKey) {
+	t.Helper()
+	srv, priv, _ := newCountingJWKSServer(t)
+	return srv, priv
+}
+
+// newCountingJWKSServer is like newTestJWKSServer but also returns a counter
+// of JWKS requests served.
+func newCountingJWKSServer(t *testing.T) (*httptest.Server, ed25519.PrivateKey, *int32) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testJWKS(pub)) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, priv, &fetches
+}
+
+// testJWKS returns a JWKS document publishing pub under testKID.
+func testJWKS(pub ed25519.PublicKey) []byte {
+	doc, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": testKID,
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		}},
+	})
+	return doc
+}
+
+// signTestToken builds a compact EdDSA JWT for the given payload.
+func signTestToken(t *testing.T, priv ed25519.PrivateKey, payload map[string]interface{}) string {
+	t.Helper()
+	return signTestTokenWithKID(t, priv, testKID, payload)
+}
+
+// signTestTokenWithKID is like signTestToken but sets an explicit kid header.
+func signTestTokenWithKID(t *testing.T, priv ed25519.PrivateKey, kid string, payload map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "typ": "JWT", "kid": kid})
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	sig := ed25519.Sign(priv, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// --- Verify tests ---
+
+func TestVerify_ValidToken(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want %q", claims.UserID, "user-1")
+	}
+}
+
+func TestVerify_UnencodedPayloadRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	// RFC 7797: the payload is signed and transmitted as-is, not base64url.
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"` + testKID + `","b64":false,"crit":["b64"]}`))
+	payload := `{"sub":"user-1"}`
+	sig := ed25519.Sign(priv, []byte(header+"."+payload))
+	token := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	_, err = c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), "b64=false") {
+		t.Errorf("error = %q; want it to mention b64=false", err)
+	}
+}
+
+func TestVerify_UnknownCritRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"` + testKID + `","crit":["exp"]}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+	sig := ed25519.Sign(priv, []byte(header+"."+payload))
+	token := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerify_JSONSerializedJWSRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	compact := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	parts := strings.Split(compact, ".")
+	jws, _ := json.Marshal(map[string]string{
+		"protected": parts[0],
+		"payload":   parts[1],
+		"signature": parts[2],
+	})
+
+	_, err = c.VerifyToken(context.Background(), " "+string(jws))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), "JSON-serialized JWS is not supported; use compact form") {
+		t.Errorf("error = %q; want it to name the JSON serialization", err)
+	}
+}
+
+func TestVerify_StripsBearerPrefix(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	bare, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken(bare) error: %v", err)
+	}
+	for _, prefix := range []string{"Bearer ", "bearer ", "BEARER "} {
+		claims, err := c.VerifyToken(context.Background(), prefix+token)
+		if err != nil {
+			t.Errorf("VerifyToken(%q+token) error: %v", prefix, err)
+			continue
+		}
+		if claims.UserID != bare.UserID || claims.Token != bare.Token {
+			t.Errorf("VerifyToken(%q+token) = %+v; want same as bare token", prefix, claims)
+		}
+	}
+}
+
+// signStdBase64Token builds a JWT whose segments are encoded with enc
+// instead of base64url.
+func signStdBase64Token(priv ed25519.PrivateKey, enc *base64.Encoding, payload map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "typ": "JWT", "kid": testKID})
+	body, _ := json.Marshal(payload)
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(body)
+	sig := ed25519.Sign(priv, []byte(signingInput))
+	return signingInput + "." + enc.EncodeToString(sig)
+}
+
+func TestVerify_TolerantBase64(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	// "???" puts a "/" into the standard base64 payload segment.
+	payload := map[string]interface{}{"sub": "user-1", "note": "???"}
+
+	strict, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	tolerant, err := New(Config{Domain: srv.URL, TolerantBase64: true})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for name, enc := range map[string]*base64.Encoding{"padded": base64.StdEncoding, "unpadded": base64.RawStdEncoding} {
+		token := signStdBase64Token(priv, enc, payload)
+		if _, err := strict.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: strict VerifyToken() error = %v; want ErrInvalidToken", name, err)
+		}
+		claims, err := tolerant.VerifyToken(context.Background(), token)
+		if err != nil {
+			t.Errorf("%s: tolerant VerifyToken() error: %v", name, err)
+			continue
+		}
+		if claims.UserID != "user-1" {
+			t.Errorf("%s: UserID = %q; want user-1", name, claims.UserID)
+		}
+	}
+}
+
+func TestVerify_PreVerifyHook(t *testing.T) {
+	srv, priv, fetches := newCountingJWKSServer(t)
+	errBadKid := errors.New("kid from blocked source")
+	var seen TokenHeader
+	c, err := New(Config{
+		Domain: srv.URL,
+		PreVerifyHook: func(h TokenHeader) error {
+			seen = h
+			if h.Kid == "blocked" {
+				return errBadKid
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	// A garbage signature would fail verification; the hook must run first.
+	token := signTestTokenWithKID(t, priv, "blocked", map[string]interface{}{"sub": "user-1"})
+	token = token[:strings.LastIndex(token, ".")+1] + "garbage"
+	_, err = c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, errBadKid) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want the hook's error and ErrInvalidToken", err)
+	}
+	if seen.Kid != "blocked" || seen.Alg != "EdDSA" || seen.Typ != "JWT" {
+		t.Errorf("hook saw header %+v", seen)
+	}
+	if n := atomic.LoadInt32(fetches); n != 0 {
+		t.Errorf("JWKS fetched %d times; want 0", n)
+	}
+
+	if _, err := c.VerifyToken(context.Background(), signTestToken(t, priv, map[string]interface{}{"sub": "user-1"})); err != nil {
+		t.Errorf("VerifyToken(allowed kid) error: %v", err)
+	}
+}
+
+func TestVerify_RawJSONPreservesPayload(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	// 2^53+1 cannot be represented exactly as a float64.
+	payload := `{"sub":"user-1","big":9007199254740993,"a":1}`
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","kid":"` + testKID + `"}`))
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(signingInput)))
+
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if got := string(claims.RawJSON()); got != payload {
+		t.Errorf("RawJSON() = %s; want %s", got, payload)
+	}
+
+	// The returned slice is a copy.
+	claims.RawJSON()[0] = 'X'
+	if got := string(claims.RawJSON()); got != payload {
+		t.Errorf("RawJSON() after mutating a previous result = %s; want %s", got, payload)
+	}
+}
+
+func TestVerify_RawKeepsLargeIntegersExact(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, RawNumberMode: RawJSONNumber})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	const jti = int64(1)<<53 + 1
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"jti": jti,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	got, ok := claims.IntClaim("jti")
+	if !ok || got != jti {
+		t.Errorf("IntClaim(jti) = %d, %v; want %d, true", got, ok, jti)
+	}
+	if _, isNumber := claims.Raw["jti"].(json.Number); !isNumber {
+		t.Errorf("Raw[jti] type = %T; want json.Number", claims.Raw["jti"])
+	}
+	if claims.ExpiresAt == 0 || claims.IssuedAt == 0 {
+		t.Errorf("ExpiresAt = %d, IssuedAt = %d; want both parsed", claims.ExpiresAt, claims.IssuedAt)
+	}
+}
+
+func TestVerify_RawNumberModes(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	const big = int64(1)<<53 + 1
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub":    "user-1",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"score":  2.5,
+		"big":    big,
+		"nested": map[string]interface{}{"n": 7},
+	})
+
+	tests := []struct {
+		mode     RawNumberMode
+		wantType string
+	}{
+		{RawFloat64, "float64"},
+		{RawJSONNumber, "json.Number"},
+	}
+	for _, tt := range tests {
+		c, err := New(Config{Domain: srv.URL, RawNumberMode: tt.mode})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		claims, err := c.VerifyToken(context.Background(), token)
+		if err != nil {
+			t.Fatalf("mode %d: VerifyToken() error: %v", tt.mode, err)
+		}
+		if got := fmt.Sprintf("%T", claims.Raw["score"]); got != tt.wantType {
+			t.Errorf("mode %d: Raw[score] type = %s; want %s", tt.mode, got, tt.wantType)
+		}
+		if got := fmt.Sprintf("%T", claims.Raw["nested"].(map[string]interface{})["n"]); got != tt.wantType {
+			t.Errorf("mode %d: nested number type = %s; want %s", tt.mode, got, tt.wantType)
+		}
+		if f, ok := claims.FloatClaim("score"); !ok || f != 2.5 {
+			t.Errorf("mode %d: FloatClaim(score) = %v, %v; want 2.5, true", tt.mode, f, ok)
+		}
+		if n, ok := claims.IntClaim("big"); !ok || n != big {
+			t.Errorf("mode %d: IntClaim(big) = %d, %v; want %d, true", tt.mode, n, ok, big)
+		}
+	}
+}
+
+func TestVerify_AuthTime(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	authTime := time.Now().Add(-time.Minute).Unix()
+
+	with := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp, "auth_time": authTime})
+	claims, err := c.VerifyToken(context.Background(), with)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.AuthTime != authTime {
+		t.Errorf("AuthTime = %d; want %d", claims.AuthTime, authTime)
+	}
+
+	without := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+	claims, err = c.VerifyToken(context.Background(), without)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.AuthTime != 0 {
+		t.Errorf("AuthTime = %d; want 0 without auth_time", claims.AuthTime)
+	}
+}
+
+func TestVerify_AuthMethodsAndContextClass(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"amr": []string{"pwd", "otp"},
+		"acr": "urn:acr:mfa",
+	})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if len(claims.AuthMethods) != 2 || claims.AuthMethods[0] != "pwd" || claims.AuthMethods[1] != "otp" {
+		t.Errorf("AuthMethods = %v; want [pwd otp]", claims.AuthMethods)
+	}
+	if claims.AuthContextClass != "urn:acr:mfa" {
+		t.Errorf("AuthContextClass = %q; want urn:acr:mfa", claims.AuthContextClass)
+	}
+}
+
+func TestVerify_FractionalExp(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	exp := float64(time.Now().Add(time.Hour).Unix()) + 0.5
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.ExpiresAt != int64(exp) {
+		t.Errorf("ExpiresAt = %d; want %d", claims.ExpiresAt, int64(exp))
+	}
+}
+
+func TestDecodePayload_TrailingData(t *testing.T) {
+	if _, err := decodePayload([]byte(`{"sub":"a"} {"sub":"b"}`)); err == nil {
+		t.Error("decodePayload() with trailing data should return error")
+	}
+}
+
+func TestVerify_TokenTooLarge(t *testing.T) {
+	c, err := New(Config{Domain: "https://test.example.com", MaxTokenBytes: 64})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	_, err = c.VerifyToken(context.Background(), strings.Repeat("a", 65))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), "token too large") {
+		t.Errorf("VerifyToken() error = %q; want it to mention token too large", err)
+	}
+}
+
+func TestVerify_DefaultMaxTokenBytes(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.VerifyToken(context.Background(), strings.Repeat("a", DefaultMaxTokenBytes+1))
+	if err == nil || !strings.Contains(err.Error(), "token too large") {
+		t.Errorf("VerifyToken() error = %v; want token too large", err)
+	}
+}
+
+func TestVerify_StringExpInPast(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"exp": strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10),
+	})
+	_, err = c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("VerifyToken() error = %v; want ErrTokenExpired", err)
+	}
+}
+
+func TestVerify_StringExpInFuture(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"exp": strconv.FormatInt(exp, 10),
+		"iat": strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.ExpiresAt != exp {
+		t.Errorf("ExpiresAt = %d; want %d", claims.ExpiresAt, exp)
+	}
+	if claims.IssuedAt == 0 {
+		t.Error("IssuedAt = 0; want string iat to be parsed")
+	}
+}
+
+func TestVerify_UnparseableExpRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for _, exp := range []interface{}{"tomorrow", true, []interface{}{1}, nil} {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+		_, err = c.VerifyToken(context.Background(), token)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("VerifyToken(exp=%v) error = %v; want ErrInvalidToken", exp, err)
+		}
+	}
+}
+
+func TestVerify_OutOfRangeExpRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	// Out-of-range values must not wrap to a negative exp that would skip
+	// the expiry check.
+	for _, exp := range []interface{}{"1e30", "99999999999999999999", "-1e30", 1e30} {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": exp})
+		_, err = c.VerifyToken(context.Background(), token)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("VerifyToken(exp=%v) error = %v; want ErrInvalidToken", exp, err)
+		}
+	}
+}
+
+func TestVerify_NonPositiveTimeClaimsRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for _, claim := range []string{"exp", "nbf"} {
+		for _, v := range []interface{}{-1, 0, "-5"} {
+			token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", claim: v})
+			_, err = c.VerifyToken(context.Background(), token)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyToken(%s=%v) error = %v; want ErrInvalidToken", claim, v, err)
+			}
+		}
+	}
+}
+
+func TestToNumericDate_Bounds(t *testing.T) {
+	for _, v := range []interface{}{"1e30", "99999999999999999999", "9223372036854775808", 9.3e18, "NaN"} {
+		if n, ok := toNumericDate(v); ok {
+			t.Errorf("toNumericDate(%v) = %d, true; want false", v, n)
+		}
+	}
+	if n, ok := toNumericDate("1700000000.9"); !ok || n != 1700000000 {
+		t.Errorf("toNumericDate(fractional) = %d, %v; want 1700000000, true", n, ok)
+	}
+}
+
+func TestVerify_UnparseableNbfRejected(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "nbf": "soon"})
+	_, err = c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+// --- Audience migration tests ---
+
+func TestVerify_DeprecatedAudienceCallback(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	var reported []string
+	c, err := New(Config{
+		Domain:               srv.URL,
+		Audience:             "api.new",
+		DeprecatedAudiences:  []string{"api.old"},
+		OnDeprecatedAudience: func(aud string) { reported = append(reported, aud) },
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	newToken := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "api.new"})
+	if _, err := c.VerifyToken(context.Background(), newToken); err != nil {
+		t.Fatalf("VerifyToken(api.new) error: %v", err)
+	}
+	if len(reported) != 0 {
+		t.Errorf("callback fired for new audience: %v", reported)
+	}
+
+	oldToken := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "api.old"})
+	if _, err := c.VerifyToken(context.Background(), oldToken); err != nil {
+		t.Fatalf("VerifyToken(api.old) error: %v", err)
+	}
+	if len(reported) != 1 || reported[0] != "api.old" {
+		t.Errorf("callback reports = %v; want [api.old]", reported)
+	}
+
+	// A token carrying both is on the new audience already.
+	bothToken := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": []string{"api.old", "api.new"}})
+	if _, err := c.VerifyToken(context.Background(), bothToken); err != nil {
+		t.Fatalf("VerifyToken(both) error: %v", err)
+	}
+	if len(reported) != 1 {
+		t.Errorf("callback fired for token that also carries the new audience: %v", reported)
+	}
+}
+
+func TestVerify_AudiencesList(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, Audiences: []string{"api-1", "api-2"}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for _, aud := range []string{"api-1", "api-2"} {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": aud})
+		if _, err := c.VerifyToken(context.Background(), token); err != nil {
+			t.Errorf("VerifyToken(%s) error: %v", aud, err)
+		}
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "api-3"})
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken(api-3) error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerify_AudienceFuncSwappedLive(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	var current atomic.Value
+	current.Store([]string{"api.blue"})
+	c, err := New(Config{
+		Domain:       srv.URL,
+		Audiences:    []string{"api.static"},
+		AudienceFunc: func() []string { return current.Load().([]string) },
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	verify := func(aud string) error {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": aud})
+		_, err := c.VerifyToken(context.Background(), token)
+		return err
+	}
+
+	if err := verify("api.blue"); err != nil {
+		t.Errorf("before cutover: VerifyToken(api.blue) error: %v", err)
+	}
+	if err := verify("api.green"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("before cutover: VerifyToken(api.green) error = %v; want ErrInvalidToken", err)
+	}
+
+	current.Store([]string{"api.green"})
+	if err := verify("api.green"); err != nil {
+		t.Errorf("after cutover: VerifyToken(api.green) error: %v", err)
+	}
+	if err := verify("api.blue"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("after cutover: VerifyToken(api.blue) error = %v; want ErrInvalidToken", err)
+	}
+	if err := verify("api.static"); err != nil {
+		t.Errorf("static audience: VerifyToken(api.static) error: %v", err)
+	}
+}
+
+func TestVerify_AudienceFuncEmptyStillChecks(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, AudienceFunc: func() []string { return nil }})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "aud": "api-1"})
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+// --- ClockSkew tests ---
+
+// fixedNow is the pinned verification time for clock skew tests.
+var fixedNow = time.Unix(1700000000, 0)
+
+// newSkewTestClient returns a client for cfg whose verifier sees fixedNow.
+func newSkewTestClient(t *testing.T, cfg Config) (*Client, ed25519.PrivateKey) {
+	t.Helper()
+	srv, priv := newTestJWKSServer(t)
+	cfg.Domain = srv.URL
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	c.verifier.now = func() time.Time { return fixedNow }
+	return c, priv
+}
+
+func verifyAt(t *testing.T, c *Client, priv ed25519.PrivateKey, claim string, offset int64) error {
+	t.Helper()
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", claim: fixedNow.Unix() + offset})
+	_, err := c.VerifyToken(context.Background(), token)
+	return err
+}
+
+// skew returns d as a Config.ClockSkew value.
+func skew(d time.Duration) *time.Duration { return &d }
+
+func TestVerify_DefaultClockSkewBoundaries(t *testing.T) {
+	c, priv := newSkewTestClient(t, Config{})
+
+	if err := verifyAt(t, c, priv, "nbf", 30); err != nil {
+		t.Errorf("nbf == now+30: error = %v; want nil", err)
+	}
+	if err := verifyAt(t, c, priv, "nbf", 31); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("nbf == now+31: error = %v; want ErrInvalidToken", err)
+	}
+	if err := verifyAt(t, c, priv, "exp", 0); err != nil {
+		t.Errorf("exp == now: error = %v; want nil", err)
+	}
+	if err := verifyAt(t, c, priv, "exp", -1); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("exp == now-1: error = %v; want ErrTokenExpired (exp is strict by default)", err)
+	}
+}
+
+func TestVerify_NotBeforeParsed(t *testing.T) {
+	c, priv := newSkewTestClient(t, Config{})
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "nbf": fixedNow.Unix() + 10})
+
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.NotBefore != fixedNow.Unix()+10 {
+		t.Errorf("NotBefore = %d; want %d", claims.NotBefore, fixedNow.Unix()+10)
+	}
+}
+
+func TestVerify_NotBeforeErrorIncludesDelta(t *testing.T) {
+	c, priv := newSkewTestClient(t, Config{})
+
+	err := verifyAt(t, c, priv, "nbf", 45)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("error = %v; want ErrInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), "nbf is 45s in the future") {
+		t.Errorf("error = %q; want the 45s delta", err)
+	}
+}
+
+func TestVerify_RejectTokensIssuedBefore(t *testing.T) {
+	cutoff := fixedNow.Add(-time.Hour)
+	c, priv := newSkewTestClient(t, Config{RejectTokensIssuedBefore: cutoff})
+
+	if err := verifyAt(t, c, priv, "iat", -3601); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("iat just before cutoff: error = %v; want ErrInvalidToken", err)
+	}
+	if err := verifyAt(t, c, priv, "iat", -3600); err != nil {
+		t.Errorf("iat at cutoff: error = %v; want nil", err)
+	}
+	if err := verifyAt(t, c, priv, "iat", -3599); err != nil {
+		t.Errorf("iat just after cutoff: error = %v; want nil", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1"})
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("no iat: error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerify_CustomClockSkewBoundaries(t *testing.T) {
+	c, priv := newSkewTestClient(t, Config{ClockSkew: skew(10 * time.Second)})
+
+	if err := verifyAt(t, c, priv, "nbf", 10); err != nil {
+		t.Errorf("nbf == now+skew: error = %v; want nil", err)
+	}
+	if err := verifyAt(t, c, priv, "nbf", 11); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("nbf == now+skew+1: error = %v; want ErrInvalidToken", err)
+	}
+	if err := verifyAt(t, c, priv, "exp", -10); err != nil {
+		t.Errorf("exp == now-skew: error = %v; want nil", err)
+	}
+	if err := verifyAt(t, c, priv, "exp", -11); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("exp == now-skew-1: error = %v; want ErrTokenExpired", err)
+	}
+}
+
+func TestVerify_NoClockSkew(t *testing.T) {
+	c, priv := newSkewTestClient(t, Config{ClockSkew: skew(0)})
+
+	if err := verifyAt(t, c, priv, "nbf", 0); err != nil {
+		t.Errorf("nbf == now: error = %v; want nil", err)
+	}
+	if err := verifyAt(t, c, priv, "nbf", 1); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("nbf == now+1: error = %v; want ErrInvalidToken", err)
+	}
+	if err := verifyAt(t, c, priv, "exp", -1); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("exp == now-1: error = %v; want ErrTokenExpired", err)
+	}
+}
+
+// --- TenantJWKSURL tests ---
+
+// newTenantTestClient returns a client whose JWKS URL is selected per tenant
+// from the given servers; unknown tenants are rejected.
+func newTenantTestClient(t *testing.T, domain string, tenants map[string]*httptest.Server) *Client {
+	t.Helper()
+	c, err := New(Config{
+		Domain: domain,
+		TenantJWKSURL: func(tid string) string {
+			if srv, ok := tenants[tid]; ok {
+				return srv.URL + "/tenants/" + tid + "/.well-known/jwks.json"
+			}
+			return ""
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return c
+}
+
+func TestVerify_TenantJWKSURL_SeparateKeys(t *testing.T) {
+	srvA, privA := newTestJWKSServer(t)
+	srvB, privB := newTestJWKSServer(t)
+	c := newTenantTestClient(t, "https://test.example.com", map[string]*httptest.Server{
+		"acme":   srvA,
+		"globex": srvB,
+	})
+
+	for tid, priv := range map[string]ed25519.PrivateKey{"acme": privA, "globex": privB} {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "tid": tid})
+		claims, err := c.VerifyToken(context.Background(), token)
+		if err != nil {
+			t.Fatalf("VerifyToken(tid=%s) error: %v", tid, err)
+		}
+		if claims.TenantID != tid {
+			t.Errorf("TenantID = %q; want %q", claims.TenantID, tid)
+		}
+	}
+}
+
+func TestVerify_RequireIssuerMatchesDomain(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		iss     string
+		require bool
+		wantErr bool
+	}{
+		{srv.URL, true, false},
+		{srv.URL + "/", true, false},
+		{srv.URL + "/tenants/acme", true, false},
+		{"https://other.example.com", true, true},
+		{srv.URL + ".evil.test", true, true},
+		{"", true, true},
+		{"https://other.example.com", false, false},
+	}
+	for _, tt := range tests {
+		c, err := New(Config{Domain: srv.URL, RequireIssuerMatchesDomain: tt.require})
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "iss": tt.iss, "exp": exp})
+		_, err = c.VerifyToken(context.Background(), token)
+		if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("iss %q, require=%v: error = %v; want ErrInvalidToken", tt.iss, tt.require, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("iss %q, require=%v: error = %v; want nil", tt.iss, tt.require, err)
+		}
+	}
+}
+
+func TestVerify_ExpectedAuthorizedParty(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, ExpectedAuthorizedParty: "web-app"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	match := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "azp": "web-app", "exp": exp})
+	claims, err := c.VerifyToken(context.Background(), match)
+	if err != nil {
+		t.Fatalf("matching azp: VerifyToken() error: %v", err)
+	}
+	if claims.AuthorizedParty != "web-app" {
+		t.Errorf("AuthorizedParty = %q; want web-app", claims.AuthorizedParty)
+	}
+
+	for name, payload := range map[string]map[string]interface{}{
+		"mismatched azp": {"sub": "user-1", "azp": "mobile-app", "exp": exp},
+		"absent azp":     {"sub": "user-1", "exp": exp},
+	} {
+		_, err := c.VerifyToken(context.Background(), signTestToken(t, priv, payload))
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: error = %v; want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerify_AllowedTenants(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, AllowedTenants: []string{"acme", "globex"}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	allowed := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "tid": "globex", "exp": exp})
+	if claims, err := c.VerifyToken(context.Background(), allowed); err != nil || claims.TenantID != "globex" {
+		t.Errorf("allowed tenant: VerifyToken() = %v, %v; want globex claims", claims, err)
+	}
+
+	for name, payload := range map[string]map[string]interface{}{
+		"disallowed tenant": {"sub": "user-1", "tid": "initech", "exp": exp},
+		"no tid":            {"sub": "user-1", "exp": exp},
+	} {
+		_, err := c.VerifyToken(context.Background(), signTestToken(t, priv, payload))
+		if !errors.Is(err, ErrTenantNotAllowed) || !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s: error = %v; want ErrForbidden and ErrTenantNotAllowed", name, err)
+		}
+	}
+}
+
+func TestVerify_TenantJWKSURL_CrossTenantKeyRejected(t *testing.T) {
+	srvA, _ := newTestJWKSServer(t)
+	srvB, privB := newTestJWKSServer(t)
+	c := newTenantTestClient(t, "https://test.example.com", map[string]*httptest.Server{
+		"acme":   srvA,
+		"globex": srvB,
+	})
+
+	// Signed by globex but claiming to belong to acme.
+	token := signTestToken(t, privB, map[string]interface{}{"sub": "user-1", "tid": "acme"})
+	_, err := c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerify_TenantJWKSURL_UnknownTenantRejected(t *testing.T) {
+	srvA, privA := newTestJWKSServer(t)
+	c := newTenantTestClient(t, "https://test.example.com", map[string]*httptest.Server{"acme": srvA})
+
+	token := signTestToken(t, privA, map[string]interface{}{"sub": "user-1", "tid": "initech"})
+	_, err := c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "unknown tenant") {
+		t.Errorf("VerifyToken() error = %v; want unknown tenant", err)
+	}
+}
+
+func TestVerify_TenantJWKSURL_BogusTenantsNotCached(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenants/acme/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(testJWKS(pub)) //nolint:errcheck
+	}))
+	defer srv.Close()
+	// A permissive TenantJWKSURL, mapping any tid to a URL.
+	c, err := New(Config{
+		Domain:        "https://test.example.com",
+		TenantJWKSURL: func(tid string) string { return srv.URL + "/tenants/" + tid + "/jwks.json" },
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "tid": fmt.Sprintf("bogus-%d", i)})
+		if _, err := c.VerifyToken(context.Background(), token); err == nil {
+			t.Fatalf("VerifyToken(tid=bogus-%d) error = nil; want error", i)
+		}
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "tid": "acme"})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken(tid=acme) error: %v", err)
+	}
+
+	c.verifier.extraJWKS.mu.Lock()
+	n := len(c.verifier.extraJWKS.byURL)
+	c.verifier.extraJWKS.mu.Unlock()
+	if n != 1 {
+		t.Errorf("tenant caches = %d after 50 bogus tids; want 1 (acme only)", n)
+	}
+}
+
+func TestVerify_TenantJWKSURL_CacheBounded(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{
+		Domain:        "https://test.example.com",
+		TenantJWKSURL: func(tid string) string { return srv.URL + "/tenants/" + tid + "/jwks.json" },
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for i := 0; i < maxExtraJWKSCaches+20; i++ {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "tid": fmt.Sprintf("t%d", i)})
+		if _, err := c.VerifyToken(context.Background(), token); err != nil {
+			t.Fatalf("VerifyToken(tid=t%d) error: %v", i, err)
+		}
+	}
+
+	c.verifier.extraJWKS.mu.Lock()
+	defer c.verifier.extraJWKS.mu.Unlock()
+	if n := len(c.verifier.extraJWKS.byURL); n != maxExtraJWKSCaches {
+		t.Errorf("tenant caches = %d; want %d", n, maxExtraJWKSCaches)
+	}
+	if _, ok := c.verifier.extraJWKS.byURL[srv.URL+"/tenants/t0/jwks.json"]; ok {
+		t.Error("least recently used tenant cache was not evicted")
+	}
+}
+
+func TestVerify_TenantJWKSURL_NoTidUsesDomain(t *testing.T) {
+	srvA, _ := newTestJWKSServer(t)
+	srvDefault, privDefault := newTestJWKSServer(t)
+	c := newTenantTestClient(t, srvDefault.URL, map[string]*httptest.Server{"acme": srvA})
+
+	token := signTestToken(t, privDefault, map[string]interface{}{"sub": "user-1"})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Errorf("VerifyToken() error: %v", err)
+	}
+}
+
+func TestVerify_TenantJWKSURL_ReusesCachePerTenant(t *testing.T) {
+	srvA, privA := newTestJWKSServer(t)
+	c := newTenantTestClient(t, "https://test.example.com", map[string]*httptest.Server{"acme": srvA})
+
+	for i := 0; i < 3; i++ {
+		token := signTestToken(t, privA, map[string]interface{}{"sub": "user-1", "tid": "acme"})
+		if _, err := c.VerifyToken(context.Background(), token); err != nil {
+			t.Fatalf("VerifyToken() error: %v", err)
+		}
+	}
+	if n := len(c.verifier.extraJWKS.byURL); n != 1 {
+		t.Errorf("tenant caches = %d; want 1", n)
+	}
+}
+
+// --- AllowedIssuers tests ---
+
+func TestVerify_AllowedIssuers(t *testing.T) {
+	srvA, privA := newTestJWKSServer(t)
+	srvB, privB := newTestJWKSServer(t)
+	srvC, privC, fetchesC := newCountingJWKSServer(t)
+	c, err := New(Config{
+		Domain:         "https://test.example.com",
+		AllowedIssuers: []string{srvA.URL, srvB.URL + "/"},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for iss, priv := range map[string]ed25519.PrivateKey{srvA.URL: privA, srvB.URL: privB} {
+		token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "iss": iss})
+		claims, err := c.VerifyToken(context.Background(), token)
+		if err != nil {
+			t.Fatalf("VerifyToken(iss=%s) error: %v", iss, err)
+		}
+		if claims.Issuer != iss {
+			t.Errorf("Issuer = %q; want %q", claims.Issuer, iss)
+		}
+	}
+
+	token := signTestToken(t, privC, map[string]interface{}{"sub": "user-1", "iss": srvC.URL})
+	_, err = c.VerifyToken(context.Background(), token)
+	if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("VerifyToken(disallowed issuer) error = %v; want issuer not allowed", err)
+	}
+	if n := atomic.LoadInt32(fetchesC); n != 0 {
+		t.Errorf("disallowed issuer JWKS fetched %d times; want 0", n)
+	}
+}
+
+func TestVerify_AllowedIssuers_KeysFromOwnIssuer(t *testing.T) {
+	srvA, _ := newTestJWKSServer(t)
+	_, privB := newTestJWKSServer(t)
+	c, err := New(Config{Domain: "https://test.example.com", AllowedIssuers: []string{srvA.URL}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	// Claims issuer A but is signed with a key A does not publish.
+	token := signTestToken(t, privB, map[string]interface{}{"sub": "user-1", "iss": srvA.URL})
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerify_AllowedIssuers_MissingIss(t *testing.T) {
+	srvA, privA := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srvA.URL, AllowedIssuers: []string{srvA.URL}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, privA, map[string]interface{}{"sub": "user-1"})
+	if _, err := c.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+// --- VerifyWithJWKS tests ---
+
+// fixedTestKey is a deterministic keypair so VerifyWithJWKS can be exercised
+// against a known JWKS blob.
+var fixedTestKey = ed25519.NewKeyFromSeed([]byte("hellojohn-go-verify-with-jwks-32"))
+
+func TestVerifyWithJWKS_MatchingKid(t *testing.T) {
+	jwks := testJWKS(fixedTestKey.Public().(ed25519.PublicKey))
+	token := signTestToken(t, fixedTestKey, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	claims, err := VerifyWithJWKS(context.Background(), token, jwks)
+	if err != nil {
+		t.Fatalf("VerifyWithJWKS() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want %q", claims.UserID, "user-1")
+	}
+}
+
+func TestVerifyWithJWKS_MismatchedKid(t *testing.T) {
+	jwks := testJWKS(fixedTestKey.Public().(ed25519.PublicKey))
+	token := signTestTokenWithKID(t, fixedTestKey, "other-kid", map[string]interface{}{"sub": "user-1"})
+
+	_, err := VerifyWithJWKS(context.Background(), token, jwks)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyWithJWKS() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyWithJWKS_WrongKey(t *testing.T) {
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	jwks := testJWKS(fixedTestKey.Public().(ed25519.PublicKey))
+	token := signTestToken(t, otherPriv, map[string]interface{}{"sub": "user-1"})
+
+	_, err := VerifyWithJWKS(context.Background(), token, jwks)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyWithJWKS() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyWithJWKS_Options(t *testing.T) {
+	jwks := testJWKS(fixedTestKey.Public().(ed25519.PublicKey))
+	token := signTestToken(t, fixedTestKey, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+
+	if _, err := VerifyWithJWKS(context.Background(), token, jwks); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("VerifyWithJWKS() error = %v; want ErrTokenExpired", err)
+	}
+	if _, err := VerifyWithJWKS(context.Background(), token, jwks, WithoutExpiryCheck()); err != nil {
+		t.Errorf("VerifyWithJWKS(WithoutExpiryCheck) error: %v", err)
+	}
+}
+
+func TestVerifyWithJWKS_InvalidJWKS(t *testing.T) {
+	token := signTestToken(t, fixedTestKey, map[string]interface{}{"sub": "user-1"})
+	if _, err := VerifyWithJWKS(context.Background(), token, []byte("not json")); err == nil {
+		t.Error("VerifyWithJWKS() with invalid JWKS should return error")
+	}
+}
+
+// --- act claim tests ---
+
+func TestVerify_ActorClaim(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{
+		"sub": "user-1",
+		"act": map[string]interface{}{
+			"sub": "support-agent",
+			"act": map[string]interface{}{"sub": "gateway"},
+		},
+	})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if !claims.IsDelegated() {
+		t.Fatal("IsDelegated() = false; want true")
+	}
+	if claims.Actor.Subject != "support-agent" {
+		t.Errorf("Actor.Subject = %q; want %q", claims.Actor.Subject, "support-agent")
+	}
+	if claims.Actor.Actor == nil || claims.Actor.Actor.Subject != "gateway" {
+		t.Errorf("Actor.Actor = %+v; want subject gateway", claims.Actor.Actor)
+	}
+}
+
+func TestVerify_NoActorClaim(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1"})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.IsDelegated() || claims.Actor != nil {
+		t.Errorf("Actor = %+v; want nil", claims.Actor)
+	}
+}
+
+func TestExtractActor_NonObject(t *testing.T) {
+	if got := extractActor("support-agent", 0); got != nil {
+		t.Errorf("extractActor(string) = %+v; want nil", got)
+	}
+}
+
+func TestExtractActor_DepthLimited(t *testing.T) {
+	var act interface{} = map[string]interface{}{"sub": "root"}
+	for i := 0; i < 20; i++ {
+		act = map[string]interface{}{"sub": "hop", "act": act}
+	}
+	depth := 0
+	for a := extractActor(act, 0); a != nil; a = a.Actor {
+		depth++
+	}
+	if depth != maxActorDepth {
+		t.Errorf("parsed actor depth = %d; want %d", depth, maxActorDepth)
+	}
+}
+
 // --- extractScopes tests ---
 
 func TestExtractScopes_WithScpArray(t *testing.T) {
@@ -58,6 +1306,65 @@ func TestExtractScopes_ScpTakesPrecedence(t *testing.T) {
 	}
 }
 
+func TestExtractScopesWith_Strategies(t *testing.T) {
+	payload := map[string]interface{}{
+		"scp":   []interface{}{"read"},
+		"scope": "read write",
+	}
+	tests := []struct {
+		strategy ScopeClaimStrategy
+		want     []string
+	}{
+		{ScpPrecedence, []string{"read"}},
+		{ScopePrecedence, []string{"read", "write"}},
+		{Union, []string{"read", "write"}},
+	}
+	for _, tt := range tests {
+		got := extractScopesWith(payload, tt.strategy)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("strategy %d: scopes = %v; want %v", tt.strategy, got, tt.want)
+		}
+	}
+}
+
+func TestExtractScopesWith_UnionKeepsScpOnlyScopes(t *testing.T) {
+	payload := map[string]interface{}{
+		"scp":   []interface{}{"admin", "read"},
+		"scope": "read write",
+	}
+	got := extractScopesWith(payload, Union)
+	if strings.Join(got, " ") != "admin read write" {
+		t.Errorf("scopes = %v; want [admin read write]", got)
+	}
+}
+
+func TestExtractScopesWith_SingleClaimIgnoresStrategy(t *testing.T) {
+	for _, strategy := range []ScopeClaimStrategy{ScpPrecedence, ScopePrecedence, Union} {
+		if got := extractScopesWith(map[string]interface{}{"scp": []interface{}{"a"}}, strategy); len(got) != 1 || got[0] != "a" {
+			t.Errorf("strategy %d, scp only: scopes = %v; want [a]", strategy, got)
+		}
+		if got := extractScopesWith(map[string]interface{}{"scope": "b"}, strategy); len(got) != 1 || got[0] != "b" {
+			t.Errorf("strategy %d, scope only: scopes = %v; want [b]", strategy, got)
+		}
+	}
+}
+
+func TestVerify_ScopeClaimStrategy(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL, ScopeClaimStrategy: Union})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "scp": []string{"read"}, "scope": "write"})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if !claims.HasScope("read") || !claims.HasScope("write") {
+		t.Errorf("Scopes = %v; want read and write", claims.Scopes)
+	}
+}
+
 func TestExtractScopes_EmptyPayload(t *testing.T) {
 	payload := map[string]interface{}{}
 	scopes := extractScopes(payload)
@@ -90,6 +1397,43 @@ func TestExtractScopes_ScopeAsArray(t *testing.T) {
 	}
 }
 
+func TestExtractScopes_SingleElementSpaceDelimited(t *testing.T) {
+	for _, claim := range []string{"scope", "scp"} {
+		payload := map[string]interface{}{
+			claim: []interface{}{"read write"},
+		}
+		scopes := extractScopes(payload)
+		if len(scopes) != 2 || scopes[0] != "read" || scopes[1] != "write" {
+			t.Errorf("extractScopes(%s) = %v; want [read write]", claim, scopes)
+		}
+	}
+}
+
+func TestExtractScopes_MixedArrayElements(t *testing.T) {
+	payload := map[string]interface{}{
+		"scp": []interface{}{"openid", "read  write", "admin"},
+	}
+	scopes := extractScopes(payload)
+	want := []string{"openid", "read", "write", "admin"}
+	if len(scopes) != len(want) {
+		t.Fatalf("extractScopes = %v; want %v", scopes, want)
+	}
+	for i := range want {
+		if scopes[i] != want[i] {
+			t.Errorf("extractScopes = %v; want %v", scopes, want)
+			break
+		}
+	}
+}
+
+func TestExtractStringSlice_DoesNotSplitArrayElements(t *testing.T) {
+	// roles and perms arrays are taken as-is
+	result := extractStringSlice([]interface{}{"super admin"})
+	if len(result) != 1 || result[0] != "super admin" {
+		t.Errorf("extractStringSlice = %v; want [super admin]", result)
+	}
+}
+
 // --- extractStringSlice tests ---
 
 func TestExtractStringSlice_WithStringSlice(t *testing.T) {
@@ -281,6 +1625,20 @@ func TestToInt64_WithJsonNumber(t *testing.T) {
 	}
 }
 
+func TestToInt64_WithLargeJsonNumber(t *testing.T) {
+	val, ok := toInt64(json.Number("9007199254740993"))
+	if !ok || val != 9007199254740993 {
+		t.Errorf("toInt64(json.Number(\"9007199254740993\")) = %d, %v; want exact value", val, ok)
+	}
+}
+
+func TestToInt64_WithFractionalJsonNumber(t *testing.T) {
+	val, ok := toInt64(json.Number("1700000000.5"))
+	if !ok || val != 1700000000 {
+		t.Errorf("toInt64(json.Number(\"1700000000.5\")) = %d, %v; want 1700000000, true", val, ok)
+	}
+}
+
 func TestToInt64_WithInvalidJsonNumber(t *testing.T) {
 	_, ok := toInt64(json.Number("not-a-number"))
 	if ok {
@@ -318,6 +1676,38 @@ func TestToInt64_WithBool(t *testing.T) {
 	}
 }
 
+// --- toNumericDate tests ---
+
+func TestToNumericDate_WithNumericString(t *testing.T) {
+	val, ok := toNumericDate("1700000000")
+	if !ok || val != 1700000000 {
+		t.Errorf("toNumericDate(\"1700000000\") = %d, %v; want 1700000000, true", val, ok)
+	}
+}
+
+func TestToNumericDate_WithFractionalString(t *testing.T) {
+	val, ok := toNumericDate("1700000000.75")
+	if !ok || val != 1700000000 {
+		t.Errorf("toNumericDate(\"1700000000.75\") = %d, %v; want 1700000000, true", val, ok)
+	}
+}
+
+func TestToNumericDate_WithNonNumericString(t *testing.T) {
+	if _, ok := toNumericDate("NaN"); ok {
+		t.Error("toNumericDate(\"NaN\") ok = true; want false")
+	}
+	if _, ok := toNumericDate("later"); ok {
+		t.Error("toNumericDate(\"later\") ok = true; want false")
+	}
+}
+
+func TestToNumericDate_WithFloat64(t *testing.T) {
+	val, ok := toNumericDate(float64(1700000000))
+	if !ok || val != 1700000000 {
+		t.Errorf("toNumericDate(float64) = %d, %v; want 1700000000, true", val, ok)
+	}
+}
+
 // --- toInt64OrZero tests ---
 
 func TestToInt64OrZero_WithFloat(t *testing.T) {
@@ -366,3 +1756,277 @@ func TestContainsString_NilSlice(t *testing.T) {
 		t.Error("containsString(nil, a) = true; want false")
 	}
 }
+
+func TestVerify_Trace(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	var traces []VerifyTrace
+	c, err := New(Config{Domain: srv.URL, Trace: func(tr VerifyTrace) { traces = append(traces, tr) }})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := c.VerifyToken(context.Background(), token); err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+
+	if len(traces) != 1 {
+		t.Fatalf("Trace called %d times; want 1", len(traces))
+	}
+	tr := traces[0]
+	for name, d := range map[string]time.Duration{
+		"Decode":          tr.Decode,
+		"KeyLookup":       tr.KeyLookup,
+		"Signature":       tr.Signature,
+		"ClaimValidation": tr.ClaimValidation,
+	} {
+		if d < 0 {
+			t.Errorf("%s = %v; want >= 0", name, d)
+		}
+	}
+	// The first verification fetches the JWKS over HTTP.
+	if tr.KeyLookup <= 0 {
+		t.Errorf("KeyLookup = %v; want > 0", tr.KeyLookup)
+	}
+	if tr.Err != nil {
+		t.Errorf("Err = %v; want nil", tr.Err)
+	}
+}
+
+func TestVerify_TraceOnFailure(t *testing.T) {
+	srv, _ := newTestJWKSServer(t)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	var traces []VerifyTrace
+	c, err := New(Config{Domain: srv.URL, Trace: func(tr VerifyTrace) { traces = append(traces, tr) }})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	token := signTestToken(t, otherPriv, map[string]interface{}{"sub": "user-1"})
+	_, verr := c.VerifyToken(context.Background(), token)
+	if verr == nil {
+		t.Fatal("VerifyToken() error = nil; want signature failure")
+	}
+
+	if len(traces) != 1 {
+		t.Fatalf("Trace called %d times; want 1", len(traces))
+	}
+	if traces[0].Err != verr {
+		t.Errorf("Err = %v; want %v", traces[0].Err, verr)
+	}
+	if traces[0].ClaimValidation != 0 {
+		t.Errorf("ClaimValidation = %v; want 0 after signature failure", traces[0].ClaimValidation)
+	}
+}
+
+func TestVerify_RolesClaimMapping(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	tests := []struct {
+		name    string
+		claim   string
+		payload map[string]interface{}
+	}{
+		{
+			name:    "namespaced key",
+			claim:   "https://myapp.example.com/roles",
+			payload: map[string]interface{}{"https://myapp.example.com/roles": []string{"admin"}},
+		},
+		{
+			name:    "dotted path",
+			claim:   "realm_access.roles",
+			payload: map[string]interface{}{"realm_access": map[string]interface{}{"roles": []string{"admin"}}},
+		},
+		{
+			name:    "default",
+			claim:   "",
+			payload: map[string]interface{}{"roles": []string{"admin"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(Config{Domain: srv.URL, ClaimMapping: ClaimMapping{RolesClaim: tt.claim}})
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			tt.payload["sub"] = "user-1"
+			claims, err := c.VerifyToken(context.Background(), signTestToken(t, priv, tt.payload))
+			if err != nil {
+				t.Fatalf("VerifyToken() error: %v", err)
+			}
+			if !claims.HasRole("admin") {
+				t.Errorf("Roles = %v; want [admin]", claims.Roles)
+			}
+		})
+	}
+}
+
+func TestLookupClaim(t *testing.T) {
+	payload := map[string]interface{}{
+		"a.b": "top-level",
+		"a":   map[string]interface{}{"b": "nested", "c": map[string]interface{}{"d": "deep"}},
+		"s":   "scalar",
+	}
+	tests := []struct {
+		name string
+		want interface{}
+	}{
+		{"a.b", "top-level"}, // an exact top-level key wins over the path
+		{"a.c.d", "deep"},
+		{"a.x", nil},
+		{"s.x", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := lookupClaim(payload, tt.name); got != tt.want {
+			t.Errorf("lookupClaim(%q) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// signWithAlg builds a token whose header claims alg but is signed with priv.
+func signWithAlg(priv ed25519.PrivateKey, alg string, payload string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `","kid":"` + testKID + `"}`))
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	sig := ed25519.Sign(priv, []byte(header+"."+body))
+	return header + "." + body + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify_AlgorithmKeyMismatch(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	_, err = c.VerifyToken(context.Background(), signWithAlg(priv, "RS256", `{"sub":"user-1"}`))
+	if !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("VerifyToken() error = %v; want ErrAlgorithmMismatch", err)
+	}
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestVerify_UnregisteredAlgorithmRejectedBeforeFetch(t *testing.T) {
+	srv, priv, fetches := newCountingJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	_, err = c.VerifyToken(context.Background(), signWithAlg(priv, "none", `{"sub":"user-1"}`))
+	if !errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("VerifyToken() error = %v; want unsupported algorithm", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "EdDSA") {
+		t.Errorf("VerifyToken() error = %q; should not name an expected algorithm", err)
+	}
+	if n := atomic.LoadInt32(fetches); n != 0 {
+		t.Errorf("JWKS fetched %d times; want 0", n)
+	}
+}
+
+func TestParseJWKS_SkipsKeysDeclaringOtherAlg(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	doc, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "OKP", "crv": "Ed25519", "kid": "rs", "alg": "RS256", "x": base64.RawURLEncoding.EncodeToString(pub)},
+			{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "alg": "EdDSA", "x": base64.RawURLEncoding.EncodeToString(pub)},
+		},
+	})
+	keys, _, err := parseJWKS(doc)
+	if err != nil {
+		t.Fatalf("parseJWKS() error: %v", err)
+	}
+	if _, ok := keys["rs"]; ok {
+		t.Error("key declaring RS256 was accepted")
+	}
+	if _, ok := keys["ed"]; !ok {
+		t.Error("key declaring EdDSA was skipped")
+	}
+}
+
+func TestVerify_MaxCacheTTL(t *testing.T) {
+	srv, priv := newTestJWKSServer(t)
+	c, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	now := time.Now()
+	token := signTestToken(t, priv, map[string]interface{}{"sub": "user-1", "exp": now.Add(10 * time.Minute).Unix()})
+	claims, err := c.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if ttl := claims.MaxCacheTTL(now); ttl <= 9*time.Minute || ttl > 10*time.Minute {
+		t.Errorf("MaxCacheTTL() = %v; want about 10m", ttl)
+	}
+}
+
+// newMultiKeyJWKSServer serves one Ed25519 key per kid and returns the
+// private keys by kid.
+func newMultiKeyJWKSServer(t *testing.T, kids ...string) (*httptest.Server, map[string]ed25519.PrivateKey) {
+	t.Helper()
+	privs := make(map[string]ed25519.PrivateKey, len(kids))
+	var jwks []map[string]string
+	for _, kid := range kids {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey() error: %v", err)
+		}
+		privs[kid] = priv
+		jwks = append(jwks, map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": kid, "x": base64.RawURLEncoding.EncodeToString(pub)})
+	}
+	doc, _ := json.Marshal(map[string]interface{}{"keys": jwks})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(doc) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, privs
+}
+
+// signWithoutKID builds an EdDSA token with no kid header.
+func signWithoutKID(priv ed25519.PrivateKey, payload string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT"}`))
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	sig := ed25519.Sign(priv, []byte(header+"."+body))
+	return header + "." + body + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify_MissingKid(t *testing.T) {
+	srv, privs := newMultiKeyJWKSServer(t, "key-a", "key-b", "key-c")
+	token := signWithoutKID(privs["key-b"], `{"sub":"user-1"}`)
+
+	strict, err := New(Config{Domain: srv.URL})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if _, err := strict.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("without AllowMissingKid: error = %v; want ErrInvalidToken", err)
+	}
+
+	lenient, err := New(Config{Domain: srv.URL, AllowMissingKid: true})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	claims, err := lenient.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("with AllowMissingKid: VerifyToken() error: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("UserID = %q; want user-1", claims.UserID)
+	}
+}
+
+func TestVerify_MissingKidNoMatchingKey(t *testing.T) {
+	srv, _ := newMultiKeyJWKSServer(t, "key-a", "key-b")
+	_, stranger, _ := ed25519.GenerateKey(rand.Reader)
+
+	c, err := New(Config{Domain: srv.URL, AllowMissingKid: true})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if _, err := c.VerifyToken(context.Background(), signWithoutKID(stranger, `{"sub":"user-1"}`)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("error = %v; want ErrInvalidToken", err)
+	}
+}